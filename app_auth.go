@@ -0,0 +1,118 @@
+package twitchgo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+)
+
+// appTokenRenewMargin is how long before it expires the app access token is
+// replaced
+const appTokenRenewMargin = 5 * time.Minute
+
+var (
+	errNoClientSecret = errors.New("an app access token needs the client secret")
+	errNoUserToken    = errors.New("no user token, call Auth")
+	errNoToken        = errors.New("no token, call Auth or AuthApp")
+)
+
+// TokenType picks which access token a Request is sent with
+type TokenType int
+
+const (
+	// TokenAny sends the user token if there is one, otherwise the app token
+	// once AuthApp has been called
+	TokenAny TokenType = iota
+	// TokenUser always sends the user token, for endpoints that act as or
+	// read private data of the logged in user
+	TokenUser
+	// TokenApp always sends the app access token, fetching one if needed
+	TokenApp
+)
+
+// AuthApp gets an app access token using the client ID and secret, without
+// involving a user. Requests that don't need a user token then work without
+// calling Auth, and the app token is renewed shortly before it expires.
+func (t *Twitch) AuthApp(ctx context.Context) error {
+	_, err := t.validAppToken(ctx)
+	return err
+}
+
+func (t *Twitch) appToken() Token {
+	t.tokenMu.Lock()
+	defer t.tokenMu.Unlock()
+	return t.config.AppToken
+}
+
+func (t *Twitch) setAppToken(token Token) {
+	t.tokenMu.Lock()
+	defer t.tokenMu.Unlock()
+	t.config.AppToken = token
+	if len(t.config.path) > 0 {
+		if err := t.config.WriteConfig(t.config.path); err != nil {
+			log.Printf("Could not save the new app token: %v\n", err)
+		}
+	}
+}
+
+// validAppToken returns the app access token, getting a new one if there
+// isn't one or it is about to expire
+func (t *Twitch) validAppToken(ctx context.Context) (string, error) {
+	token := t.appToken()
+	if len(token.AccessToken) > 0 && time.Until(token.Expires) > appTokenRenewMargin {
+		return token.AccessToken, nil
+	}
+	return t.renewAppToken(ctx, token.AccessToken)
+}
+
+// renewAppToken gets a new app access token to replace stale, unless a
+// concurrent request already replaced it
+func (t *Twitch) renewAppToken(ctx context.Context, stale string) (string, error) {
+	t.refreshMu.Lock()
+	defer t.refreshMu.Unlock()
+	token := t.appToken()
+	if token.AccessToken != stale && time.Until(token.Expires) > appTokenRenewMargin {
+		return token.AccessToken, nil
+	} else if len(t.config.ClientSecret) == 0 {
+		return "", errNoClientSecret
+	}
+
+	newToken, err := t.postToken(ctx, url.Values{
+		"client_id":     {t.config.ClientID},
+		"client_secret": {t.config.ClientSecret},
+		"grant_type":    {"client_credentials"},
+	})
+	if err != nil {
+		return "", err
+	}
+	t.setAppToken(*newToken)
+	return newToken.AccessToken, nil
+}
+
+// accessTokenFor returns the access token to send a request with, and whether
+// it is the app token
+func (t *Twitch) accessTokenFor(ctx context.Context, tokenType TokenType) (string, bool, error) {
+	switch tokenType {
+	case TokenUser:
+		token := t.token().AccessToken
+		if len(token) == 0 {
+			return "", false, errNoUserToken
+		}
+		return token, false, nil
+	case TokenApp:
+		token, err := t.validAppToken(ctx)
+		return token, true, err
+	}
+
+	// Prefer the user token, falling back to the app token only once app
+	// authentication has been set up
+	if user := t.token().AccessToken; len(user) > 0 {
+		return user, false, nil
+	} else if len(t.appToken().AccessToken) == 0 {
+		return "", false, errNoToken
+	}
+	token, err := t.validAppToken(ctx)
+	return token, true, err
+}
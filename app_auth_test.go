@@ -0,0 +1,80 @@
+package twitchgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAppToken(t *testing.T) {
+	// Set up the test server, handing out numbered app tokens and recording
+	// the token each API request was sent with
+	issued := 0
+	var sent []string
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/token" {
+				r.ParseForm()
+				if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_secret") != "MySecret" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				issued++
+				fmt.Fprintf(w, `{"access_token": "app%d", "expires_in": 5000000, "token_type": "bearer"}`, issued)
+				return
+			}
+			sent = append(sent, r.Header.Get("Authorization"))
+			fmt.Fprint(w, `{"data": [{"id": "1", "login": "bot"}]}`)
+		}))
+	defer svr.Close()
+
+	twitch := NewTwitch(&Configuration{ClientID: "MyID", ClientSecret: "MySecret"})
+	twitch.BaseApiUrl = svr.URL
+	twitch.BaseAuthUrl = svr.URL
+
+	// Without any token, nothing is sent
+	if _, err := twitch.GetUserByLogin("bot"); !errors.Is(err, errNoToken) {
+		t.Fatalf(`GetUserByLogin() = got error %v, want %v`, err, errNoToken)
+	} else if len(sent) != 0 {
+		t.Fatalf(`GetUserByLogin() = sent %d requests, want none without a token`, len(sent))
+	}
+
+	// Without a user token, requests use the app token
+	if err := twitch.AuthApp(context.Background()); err != nil {
+		t.Fatalf(`AuthApp() = got error %s, want nil`, err)
+	}
+	twitch.GetUserByLogin("bot")
+	if sent[0] != "Bearer app1" {
+		t.Fatalf(`GetUserByLogin() Authorization = got %s, want Bearer app1`, sent[0])
+	}
+
+	// The app token is renewed shortly before it expires
+	token := twitch.appToken()
+	token.Expires = time.Now().Add(time.Minute)
+	twitch.setAppToken(token)
+	twitch.GetUserByLogin("bot")
+	if sent[1] != "Bearer app2" {
+		t.Fatalf(`GetUserByLogin() Authorization = got %s, want Bearer app2`, sent[1])
+	}
+
+	// Endpoints acting as the user need a user token
+	if _, err := twitch.GetFollowedStreams(User{ID: "1"}); !errors.Is(err, errNoUserToken) {
+		t.Fatalf(`GetFollowedStreams() = got error %v, want %v`, err, errNoUserToken)
+	} else if len(sent) != 2 {
+		t.Fatalf(`GetFollowedStreams() = sent %d requests, want none without a user token`, len(sent)-2)
+	}
+
+	// Once there is a user token it is preferred
+	twitch.setToken(Token{AccessToken: "user"})
+	twitch.GetUserByLogin("bot")
+	twitch.Do(context.Background(), NewRequest("GET", "/users").UseToken(TokenApp), nil)
+	if sent[2] != "Bearer user" || sent[3] != "Bearer app2" {
+		t.Fatalf(`Authorization = got %s and %s, want Bearer user and Bearer app2`, sent[2], sent[3])
+	} else if issued != 2 {
+		t.Fatalf(`issued = got %d app tokens, want 2`, issued)
+	}
+}
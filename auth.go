@@ -3,24 +3,184 @@ package twitchgo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
 
+var errNoRefreshToken = errors.New("no refresh token")
+
+// Auth logs the user in, exiting if that fails. See AuthContext.
 func (t *Twitch) Auth() {
-	if len(t.config.Token.RefreshToken) > 0 && !t.config.Token.Expires.Before(time.Now()) {
+	if err := t.AuthContext(context.Background()); err != nil {
+		log.Fatalf("Error authenticating: %v", err)
+	}
+}
+
+// AuthContext reuses or refreshes the saved token, and only when neither
+// works asks the user to log in through the browser
+func (t *Twitch) AuthContext(ctx context.Context) error {
+	ok, err := t.reuseToken(ctx)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error refreshing token: %v", err))
+	} else if ok {
+		return nil
+	}
+
+	// No usable refresh token, so the user has to log in again
+	t.fetchAuthCode()
+	token, err := t.fetchToken(ctx)
+	if err != nil {
+		return err
+	}
+	t.setToken(*token)
+	return nil
+}
+
+// reuseToken reports whether the saved token is still valid or could be
+// refreshed, so the user doesn't need to log in again
+func (t *Twitch) reuseToken(ctx context.Context) (bool, error) {
+	token := t.token()
+	if missing := t.missingScopes(token); len(token.AccessToken) > 0 && len(missing) > 0 {
+		// Refreshing keeps the old scopes, so the user has to consent to
+		// the new ones
+		log.Printf("Token is missing scopes %v, logging in again\n", missing)
+		return false, nil
+	}
+
+	if len(token.RefreshToken) > 0 && !token.Expires.Before(time.Now()) {
 		// Token is still valid
-	} else {
-		// Token expired
-		t.fetchAuthCode()
-		token := t.fetchToken()
-		t.config.Token = *token
-		t.config.WriteConfig(t.config.path)
+		return true, nil
+	}
+
+	if len(token.RefreshToken) > 0 {
+		// Token expired, try to refresh it without involving the user
+		err := t.RefreshToken(ctx)
+		if err == nil {
+			return true, nil
+		} else if !isRefreshTokenRejected(err) {
+			return false, err
+		}
+		log.Printf("Refresh token was rejected, logging in again: %v\n", err)
+	}
+	return false, nil
+}
+
+// RefreshToken swaps the refresh token for a new access token and saves it to
+// the config
+func (t *Twitch) RefreshToken(ctx context.Context) error {
+	token, err := t.refreshToken(ctx)
+	if err != nil {
+		return err
+	}
+	t.setToken(*token)
+	return nil
+}
+
+// refreshToken exchanges the refresh token for a new token
+func (t *Twitch) refreshToken(ctx context.Context) (*Token, error) {
+	current := t.token()
+	data := url.Values{
+		"client_id":     {t.config.ClientID},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {current.RefreshToken},
+	}
+	// Public clients, such as those using the device code flow, have no
+	// secret
+	if len(t.config.ClientSecret) > 0 {
+		data.Set("client_secret", t.config.ClientSecret)
+	}
+	token, err := t.postToken(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	// Twitch may hand out a new refresh token, otherwise keep the old one
+	if len(token.RefreshToken) == 0 {
+		token.RefreshToken = current.RefreshToken
+	}
+	if token.Scope == nil {
+		token.Scope = current.Scope
+	}
+	return token, nil
+}
+
+// postToken requests a token from the OAuth token endpoint
+func (t *Twitch) postToken(ctx context.Context, data url.Values) (*Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "POST", t.BaseAuthUrl+"/token", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error getting token: %v", err))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading token response: %v", err))
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, respBody)
+	}
+
+	token := new(Token)
+	if err := json.Unmarshal(respBody, &token); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error parsing token response: %v", err))
+	}
+	token.Expires = time.Now().Add(time.Second * time.Duration(token.ExpiresIn))
+	return token, nil
+}
+
+// refreshStaleToken refreshes the token after staleAccessToken was rejected,
+// unless it has already been replaced by a concurrent refresh
+func (t *Twitch) refreshStaleToken(ctx context.Context, staleAccessToken string) error {
+	t.refreshMu.Lock()
+	defer t.refreshMu.Unlock()
+	token := t.token()
+	if token.AccessToken != staleAccessToken {
+		return nil
+	} else if len(token.RefreshToken) == 0 {
+		return errNoRefreshToken
+	}
+	return t.RefreshToken(ctx)
+}
+
+// isInvalidToken reports whether Helix rejected the request's access token,
+// rather than refusing it for a missing scope or similar
+func isInvalidToken(err *APIError) bool {
+	return err.StatusCode == http.StatusUnauthorized && strings.Contains(strings.ToLower(err.Message), "invalid")
+}
+
+// isRefreshTokenRejected reports whether Twitch refused the refresh token,
+// meaning it was revoked or is invalid and retrying won't help
+func isRefreshTokenRejected(err error) bool {
+	return errors.Is(err, ErrBadRequest) || errors.Is(err, ErrUnauthorized)
+}
+
+func (t *Twitch) token() Token {
+	t.tokenMu.Lock()
+	defer t.tokenMu.Unlock()
+	return t.config.Token
+}
+
+// setToken switches to the new token and saves it, if the config was loaded
+// from a file
+func (t *Twitch) setToken(token Token) {
+	t.tokenMu.Lock()
+	defer t.tokenMu.Unlock()
+	t.config.Token = token
+	if len(t.config.path) > 0 {
+		// Keep using the new token even if it couldn't be saved
+		if err := t.config.WriteConfig(t.config.path); err != nil {
+			log.Printf("Could not save the new token: %v\n", err)
+		}
 	}
 }
 
@@ -30,8 +190,11 @@ func (t *Twitch) fetchAuthCode() {
 	t.waitGroup.Add(1)
 
 	// Setup the local HTTP server
-	t.server = http.Server{Addr: ":8080"}
-	http.HandleFunc("/", t.authCallback)
+	// Each client gets its own mux so several of them can authenticate
+	// in the same process
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", t.authCallback)
+	t.server = http.Server{Addr: ":8080", Handler: mux}
 	go func() {
 		err := t.server.ListenAndServe()
 		if err != http.ErrServerClosed {
@@ -40,7 +203,7 @@ func (t *Twitch) fetchAuthCode() {
 	}()
 
 	// Open the authentication URL to get an auth token for the logged in user
-	authURL := fmt.Sprintf("https://id.twitch.tv/oauth2/authorize?response_type=code&redirect_uri=http://localhost:8080&client_id=%s&scope=user%%3Aread%%3Afollows+chat%%3Aread", t.config.ClientID)
+	authURL := t.authorizeURL()
 
 	log.Printf("Please authenticate using your browser: %s\n", authURL)
 
@@ -49,6 +212,21 @@ func (t *Twitch) fetchAuthCode() {
 	t.server.Shutdown(context.TODO())
 }
 
+// authorizeURL is where the user logs in and consents to the scopes
+func (t *Twitch) authorizeURL() string {
+	params := url.Values{
+		"response_type": {"code"},
+		"redirect_uri":  {"http://localhost:8080"},
+		"client_id":     {t.config.ClientID},
+		"scope":         {t.scopeParam()},
+	}
+	if t.forceVerify {
+		// Show the consent screen even if the user already authorized us
+		params.Set("force_verify", "true")
+	}
+	return fmt.Sprintf("%s/authorize?%s", t.BaseAuthUrl, params.Encode())
+}
+
 func (t *Twitch) authCallback(w http.ResponseWriter, req *http.Request) {
 	// Store the auth token
 	code := req.URL.Query().Get("code")
@@ -61,30 +239,13 @@ func (t *Twitch) authCallback(w http.ResponseWriter, req *http.Request) {
 	t.waitGroup.Done()
 }
 
-func (t *Twitch) fetchToken() *Token {
-	// Build the request, providing the access code
-	tokenURL := "https://id.twitch.tv/oauth2/token"
-	data := url.Values{
+// fetchToken exchanges the code from the browser login for a token
+func (t *Twitch) fetchToken(ctx context.Context) (*Token, error) {
+	return t.postToken(ctx, url.Values{
 		"client_id":     {t.config.ClientID},
 		"client_secret": {t.config.ClientSecret},
 		"code":          {t.config.Auth},
 		"grant_type":    {"authorization_code"},
 		"redirect_uri":  {"http://localhost:8080"},
-	}
-
-	resp, err := http.PostForm(tokenURL, data)
-	if err != nil {
-		log.Fatalf("Error getting token: %v", err)
-	}
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Error reading token response: %v", err)
-	}
-
-	// Unmarshal the token
-	token := new(Token)
-	json.Unmarshal(respBody, &token)
-	token.Expires = time.Now().Add(time.Second * time.Duration(token.ExpiresIn))
-	return token
+	})
 }
@@ -0,0 +1,132 @@
+package twitchgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthRefreshesToken(t *testing.T) {
+	// Set up the test token endpoint
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if r.URL.Path != "/token" || r.PostForm.Get("grant_type") != "refresh_token" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			} else if r.PostForm.Get("refresh_token") != "oldrefresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"status": 400, "message": "Invalid refresh token"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "newaccess", "refresh_token": "newrefresh", "expires_in": 14400, "token_type": "bearer"}`)
+		}))
+	defer svr.Close()
+
+	// The config is saved back to its file after refreshing
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"client_id": "MyID", "client_secret": "MySecret", "token": {"access_token": "oldaccess", "refresh_token": "oldrefresh", "Expires": "2020-01-01T00:00:00Z", "scope": ["user:read:follows", "chat:read", "chat:edit"]}}`), 0600)
+	twitch := NewTwitch(LoadConfig(path))
+	twitch.BaseAuthUrl = svr.URL
+
+	// An expired token is refreshed without the browser flow
+	twitch.Auth()
+	token := twitch.token()
+	if token.AccessToken != "newaccess" || token.RefreshToken != "newrefresh" {
+		t.Fatalf(`Auth() token = got %s/%s, want newaccess/newrefresh`, token.AccessToken, token.RefreshToken)
+	} else if token.Expires.Before(time.Now().Add(3 * time.Hour)) {
+		t.Fatalf(`Auth() Expires = got %s, want about 4 hours from now`, token.Expires)
+	}
+	saved := LoadConfig(path)
+	if saved.Token.AccessToken != "newaccess" {
+		t.Fatalf(`Auth() saved token = got %s, want newaccess`, saved.Token.AccessToken)
+	}
+
+	// A revoked refresh token is reported as rejected
+	_, err := twitch.refreshToken(context.Background())
+	if !isRefreshTokenRejected(err) {
+		t.Fatalf(`refreshToken() = got error %v, want it rejected`, err)
+	}
+}
+
+func TestAuthContextReturnsErrors(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer svr.Close()
+
+	// A refresh failing for any reason but a rejected refresh token is
+	// returned rather than ending the process
+	twitch := NewTwitch(&Configuration{ClientID: "MyID", Token: Token{AccessToken: "old", RefreshToken: "refresh", Scope: []string{"user:read:follows", "chat:read", "chat:edit"}}})
+	twitch.BaseAuthUrl = svr.URL
+	if err := twitch.AuthContext(context.Background()); err == nil {
+		t.Fatalf(`AuthContext() = got no error, want the refresh failure`)
+	} else if got := twitch.token().AccessToken; got != "old" {
+		t.Fatalf(`AuthContext() token = got %s, want old`, got)
+	}
+}
+
+func TestOAuthTimeout(t *testing.T) {
+	// Set up the test server, never answering until the client gives up
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			<-r.Context().Done()
+		}))
+	defer svr.Close()
+
+	twitch := NewTwitch(&Configuration{ClientID: "MyID", Token: Token{RefreshToken: "refresh"}})
+	twitch.BaseAuthUrl = svr.URL
+	twitch.Timeout = 20 * time.Millisecond
+	start := time.Now()
+	if err := twitch.RefreshToken(context.Background()); err == nil {
+		t.Fatalf(`RefreshToken() = got no error, want a timeout`)
+	} else if _, err := twitch.RequestDeviceCode(context.Background()); err == nil {
+		t.Fatalf(`RequestDeviceCode() = got no error, want a timeout`)
+	} else if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf(`RefreshToken() = returned after %s, want the timeout to apply`, elapsed)
+	}
+}
+
+func TestDoRequestRefreshesInvalidToken(t *testing.T) {
+	// Set up the test server, accepting only the refreshed token
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/token":
+				fmt.Fprint(w, `{"access_token": "newaccess", "expires_in": 14400}`)
+			case r.Header.Get("Authorization") != "Bearer newaccess":
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error": "Unauthorized", "status": 401, "message": "Invalid OAuth token"}`)
+			default:
+				fmt.Fprint(w, `{"data": [{"id": "1", "login": "bot"}]}`)
+			}
+		}))
+	defer svr.Close()
+
+	twitch := NewTwitch(&Configuration{Token: Token{AccessToken: "oldaccess", RefreshToken: "refresh"}})
+	twitch.BaseApiUrl = svr.URL
+	twitch.BaseAuthUrl = svr.URL
+	u, err := twitch.GetUserByLogin("bot")
+	if err != nil {
+		t.Fatalf(`GetUserByLogin() = got error %s, want nil`, err)
+	} else if u.ID != "1" {
+		t.Fatalf(`GetUserByLogin() = got ID %s, want 1`, u.ID)
+	} else if token := twitch.token(); token.AccessToken != "newaccess" || token.RefreshToken != "refresh" {
+		t.Fatalf(`token() = got %s/%s, want newaccess/refresh`, token.AccessToken, token.RefreshToken)
+	}
+
+	// Without a refresh token the 401 is returned
+	twitch = NewTwitch(&Configuration{Token: Token{AccessToken: "oldaccess"}})
+	twitch.BaseApiUrl = svr.URL
+	if _, err := twitch.GetUserByLogin("bot"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf(`GetUserByLogin() = got error %v, want ErrUnauthorized`, err)
+	}
+}
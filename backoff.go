@@ -0,0 +1,41 @@
+package twitchgo
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes an exponential backoff with jitter. Any field left as its
+// zero value uses the default.
+type Backoff struct {
+	// Min is the delay before the first retry. Defaults to 1 second.
+	Min time.Duration
+	// Max caps the delay between retries. Defaults to 2 minutes.
+	Max time.Duration
+	// Factor is what the delay is multiplied by after each attempt. Defaults to 2.
+	Factor float64
+	// Jitter is the fraction of the delay, between 0 and 1, that is randomly
+	// taken off so that many clients don't retry in lockstep. Defaults to 0.5.
+	Jitter float64
+}
+
+// Delay returns how long to wait before the given retry attempt, starting at 0
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Min <= 0 {
+		b.Min = time.Second
+	}
+	if b.Max <= 0 {
+		b.Max = 2 * time.Minute
+	}
+	if b.Factor < 1 {
+		b.Factor = 2
+	}
+	if b.Jitter <= 0 || b.Jitter > 1 {
+		b.Jitter = 0.5
+	}
+
+	delay := math.Min(float64(b.Min)*math.Pow(b.Factor, float64(attempt)), float64(b.Max))
+	delay -= delay * b.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
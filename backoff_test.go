@@ -0,0 +1,26 @@
+package twitchgo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second, Factor: 2, Jitter: 0.5}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := b.Delay(tt.attempt); d < tt.min || d > tt.max {
+				t.Fatalf(`Delay(%d) = got %s, want between %s and %s`, tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -1,144 +1,475 @@
 package twitchgo
 
 import (
-	"bufio"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
-	"log"
-	"net"
-	"strconv"
+	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Chat struct {
-	Conn      net.Conn
-	Channel   string
-	Connected bool
-	Joined    bool
-	Twitch    *Twitch
+	Channel string
+	Twitch  *Twitch
+	options ChatOptions
+	login   string
+
+	handlersMu sync.RWMutex
+	handlers   chatHandlers
+
+	mu          sync.Mutex
+	conns       []*chatConn
+	channels    map[string]*chatConn
+	joinLimiter *joinLimiter
+	queue       *sendQueue
+
+	// ctx is cancelled when the chat is stopped, wg tracks the goroutine
+	// reading each connection
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+	done     chan struct{}
+	err      error
+	// inHandler counts the handlers running right now, Close can't wait for
+	// the goroutine running a handler that called it
+	inHandler int32
 }
 
-type Message struct {
-	Sender     string
-	Text       string
-	Subscriber bool
-	SubLength  int
-	Mod        bool
-	UserID     string
-	Channel    string
+// ChatOptions configures how a Chat connects to the chat server
+type ChatOptions struct {
+	// Transport selects TCP or WebSocket. Defaults to TCP.
+	Transport ChatTransport
+	// Host is the chat server to connect to. Defaults to irc.chat.twitch.tv.
+	Host string
+	// Port defaults to 6697, or 6667 when TLS is disabled
+	Port int
+	// WebSocketURL is the chat server used by the WebSocket transport.
+	// Defaults to wss://irc-ws.chat.twitch.tv:443.
+	WebSocketURL string
+	// Proxy picks the HTTP proxy used by the WebSocket transport. Defaults
+	// to http.ProxyFromEnvironment.
+	Proxy func(*http.Request) (*url.URL, error)
+	// TLSConfig is used for TLS and secure WebSocket connections, nil uses
+	// the defaults
+	TLSConfig *tls.Config
+	// DisableTLS connects in plain text, which sends the OAuth token
+	// unencrypted and should only be used for testing
+	DisableTLS bool
+	// MaxChannelsPerConnection is the number of channels joined on a single
+	// connection before another connection is opened. Defaults to 100.
+	MaxChannelsPerConnection int
+	// JoinLimit is the number of channels that can be joined every 10
+	// seconds. Defaults to 20, verified bots may raise it to 2000.
+	JoinLimit int
+	// Reconnect is the backoff used between reconnect attempts after the
+	// connection drops
+	Reconnect Backoff
+	// MessageLimit is the number of messages that can be sent every 30
+	// seconds to channels where the user isn't a moderator. Defaults to 20.
+	MessageLimit int
+	// ModMessageLimit is the number of messages that can be sent every 30
+	// seconds in total. Defaults to 100.
+	ModMessageLimit int
+	// MaxReconnectAttempts stops the chat with an error after this many
+	// failed reconnects in a row. Defaults to 0, which retries forever.
+	MaxReconnectAttempts int
+	// PingTimeout is how long the connection may go without receiving
+	// anything, including the server's keepalive PING, before it is treated
+	// as dead. Defaults to 6 minutes, as Twitch pings about every 5.
+	PingTimeout time.Duration
 }
 
-var chatCallback func(*Message)
+var (
+	errChatNotConnected = errors.New("chat is not connected")
+	errChatClosed       = errors.New("chat is closed")
+	errNoChannel        = errors.New("no channel given")
+)
+
+// ChatConnect connects to the channel's chat, calling handler with every
+// message received. Each Chat keeps its own handlers, so any number of them
+// can be used at once. The chat is closed when ctx is cancelled.
+func (t *Twitch) ChatConnect(ctx context.Context, channel string, handler func(*Message)) (*Chat, error) {
+	chat := t.NewChat(channel)
+	chat.OnMessage(handler)
+	return chat, chat.Connect(ctx)
+}
 
-func (t *Twitch) ChatConnect(channel string, handler func(*Message)) error {
-	CHAT_HOST := "irc.chat.twitch.tv:6667"
+// NewChat builds a chat client for the channel without connecting it, so
+// event handlers can be registered before calling Connect
+func (t *Twitch) NewChat(channel string) *Chat {
+	return t.NewChatWithOptions(channel, ChatOptions{})
+}
+
+// NewChatWithOptions builds a chat client for the channel using the given
+// options, any option left as its zero value uses the default
+func (t *Twitch) NewChatWithOptions(channel string, options ChatOptions) *Chat {
+	if len(options.Host) == 0 {
+		options.Host = "irc.chat.twitch.tv"
+	}
+	if options.Port == 0 {
+		if options.DisableTLS {
+			options.Port = 6667
+		} else {
+			options.Port = 6697
+		}
+	}
+	if len(options.WebSocketURL) == 0 {
+		options.WebSocketURL = "wss://irc-ws.chat.twitch.tv:443"
+	}
+	if options.Proxy == nil {
+		options.Proxy = http.ProxyFromEnvironment
+	}
+	if options.MaxChannelsPerConnection <= 0 {
+		options.MaxChannelsPerConnection = 100
+	}
+	if options.JoinLimit <= 0 {
+		options.JoinLimit = 20
+	}
+	if options.PingTimeout <= 0 {
+		options.PingTimeout = 6 * time.Minute
+	}
+	if options.MessageLimit <= 0 {
+		options.MessageLimit = 20
+	}
+	if options.ModMessageLimit <= 0 {
+		options.ModMessageLimit = 100
+	}
 
-	// Build the chat struct
 	chat := new(Chat)
 	chat.Channel = channel
 	chat.Twitch = t
+	chat.options = options
+	chat.channels = map[string]*chatConn{}
+	chat.joinLimiter = &joinLimiter{limit: options.JoinLimit, window: 10 * time.Second}
+	chat.ctx, chat.cancel = context.WithCancel(context.Background())
+	chat.done = make(chan struct{})
+	chat.queue = newSendQueue(chat)
+	return chat
+}
 
-	// Connect to the server
-	conn, err := net.Dial("tcp", CHAT_HOST)
+// Connect opens the connection to the chat server, authenticates and joins
+// the channel, if one was given. The chat keeps running until ctx is
+// cancelled or Close is called.
+func (c *Chat) Connect(ctx context.Context) error {
+	user, err := c.Twitch.GetLoggedInUserContext(ctx)
 	if err != nil {
-		log.Fatalf("Could not connect to chat server: %s", err)
+		err = errors.New(fmt.Sprintf("Error connecting to chat: %v", err))
+		c.stop(err)
+		return err
 	}
-	chat.Conn = conn
 
-	// Authenticate
-	user, err := t.GetLoggedInUser()
+	c.mu.Lock()
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.login = user.Login
+	c.mu.Unlock()
+
+	conn, err := c.dialConn()
 	if err != nil {
-		return errors.New(fmt.Sprintf("Error connecting to chat: %v", err))
+		c.stop(err)
+		return err
 	}
-	chat.sendMsg("CAP REQ :twitch.tv/membership twitch.tv/tags twitch.tv/commands")
-	chat.sendMsg("PASS oauth:" + t.config.Token.AccessToken)
-	chat.sendMsg("NICK " + user.Login)
+	c.mu.Lock()
+	c.startConn(conn)
+	c.mu.Unlock()
 
-	chatCallback = handler
+	c.wg.Add(1)
+	go c.queue.run()
 
-	go chat.readThread(conn)
+	// Stop the chat once the caller's context is done
+	go func() {
+		<-c.ctx.Done()
+		c.stop(ctx.Err())
+	}()
 
+	if len(c.Channel) > 0 {
+		return c.Join(c.Channel)
+	}
 	return nil
 }
 
-func (c *Chat) sendMsg(message string) {
-	_, err := c.Conn.Write([]byte(message + "\r\n"))
+// Close leaves every channel, disconnects from the server and waits for the
+// chat's goroutines to exit. Called from a handler, it returns once the
+// connections are closed and Wait or Done can be used to wait for the rest.
+func (c *Chat) Close() error {
+	c.mu.Lock()
+	conns := c.conns
+	stopped := c.ctx.Err() != nil
+	c.mu.Unlock()
+
+	var err error
+	for _, conn := range conns {
+		if stopped {
+			break
+		}
+		for _, channel := range conn.channelNames() {
+			if e := conn.sendIRC(&IRCMessage{Command: "PART", Params: []string{"#" + channel}}); e != nil && err == nil {
+				err = e
+			}
+		}
+		if e := conn.sendIRC(&IRCMessage{Command: "QUIT"}); e != nil && err == nil {
+			err = e
+		}
+	}
+	c.stop(nil)
+
+	if atomic.LoadInt32(&c.inHandler) == 0 {
+		<-c.done
+	}
 	if err != nil {
-		log.Fatalf("Error sending message: %s", err)
+		return err
 	}
+	return c.err
+}
+
+// Done returns a channel that is closed once the chat has stopped
+func (c *Chat) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until the chat has stopped and returns the reason: nil after
+// Close, the context's error when it was cancelled, or the error that made
+// reconnecting give up
+func (c *Chat) Wait() error {
+	<-c.done
+	return c.err
 }
 
-func (c *Chat) readThread(conn net.Conn) {
-	user, _ := c.Twitch.GetLoggedInUser()
-	reader := bufio.NewReader(conn)
-	for {
-		lineB, _, err := reader.ReadLine()
+// stop shuts every connection down, recording err as the reason the chat
+// stopped. Done is closed once every goroutine has exited, stop itself doesn't
+// wait for them since it may be called from one.
+func (c *Chat) stop(err error) {
+	c.stopOnce.Do(func() {
+		c.err = err
+		c.cancel()
+
+		c.mu.Lock()
+		conns := c.conns
+		c.mu.Unlock()
+		for _, conn := range conns {
+			conn.close()
+		}
+
+		go func() {
+			c.wg.Wait()
+			close(c.done)
+		}()
+	})
+}
+
+// Join joins another channel, opening a new connection if every open one has
+// reached ChatOptions.MaxChannelsPerConnection. Join blocks while the join
+// rate limit is exhausted.
+func (c *Chat) Join(channel string) error {
+	channel = normalizeChannel(channel)
+	if len(channel) == 0 {
+		return errNoChannel
+	}
+
+	c.mu.Lock()
+	if c.ctx.Err() != nil {
+		c.mu.Unlock()
+		return errChatClosed
+	} else if len(c.conns) == 0 {
+		c.mu.Unlock()
+		return errChatNotConnected
+	}
+	if _, ok := c.channels[channel]; ok {
+		c.mu.Unlock()
+		return nil
+	}
+
+	// Find a connection with room for the channel, or open a new one
+	var conn *chatConn
+	for _, s := range c.conns {
+		if s.channelCount() < c.options.MaxChannelsPerConnection {
+			conn = s
+			break
+		}
+	}
+	if conn == nil {
+		// Dialing can take a while, don't hold up everything else using
+		// the lock in the meantime
+		c.mu.Unlock()
+		newConn, err := c.dialConn()
 		if err != nil {
-			log.Fatalf("Error reading from server: %s", err)
+			return err
 		}
-		line := string(lineB)
-
-		if strings.Contains(line, ":tmi.twitch.tv 001 "+strings.ToLower(user.Login)+" :Welcome, GLHF!") {
-			// We've authenticated to the server
-			c.Connected = true
-			c.joinChannel()
-		} else if strings.Contains(line, " 366 "+strings.ToLower(user.Login)+" #"+strings.ToLower(c.Channel)) {
-			// We've joined the desired channel
-			c.Joined = true
-		} else if strings.Contains(line, "PING") {
-			// Respond to Keepalive message
-			c.sendPong(line)
-		} else if strings.Contains(line, ".tmi.twitch.tv PRIVMSG #"+strings.ToLower(c.Channel)+" :") {
-			// Read a message in the streams chat
-			m := c.parseMessage(line)
-			chatCallback(m)
+
+		c.mu.Lock()
+		if c.ctx.Err() != nil {
+			c.mu.Unlock()
+			newConn.close()
+			return errChatClosed
+		} else if _, ok := c.channels[channel]; ok {
+			// The channel was joined while we were dialing
+			c.mu.Unlock()
+			newConn.close()
+			return nil
 		}
+		c.startConn(newConn)
+		conn = newConn
+	}
+	c.channels[channel] = conn
+	sendNow := conn.join(channel)
+	c.mu.Unlock()
+
+	if sendNow {
+		return conn.sendJoin(channel)
 	}
+	return nil
 }
 
-func (c *Chat) joinChannel() {
-	c.sendMsg("JOIN #" + c.Channel)
-}
-
-func (c *Chat) sendPong(line string) {
-	rsp := strings.Replace(line, "PING", "PONG", 1)
-	c.sendMsg(rsp)
-}
-
-func (c *Chat) parseMessage(line string) *Message {
-	m := new(Message)
-	m.Channel = c.Channel
-
-	// Parse the advanced tags to pull the user, sub, and mod info
-	tags := strings.Split(strings.Split(line, "!")[0][1:], ";")
-	for _, tag := range tags {
-		tagSplit := strings.Split(tag, "=")
-		key := tagSplit[0]
-		val := tagSplit[1]
-		if key == "display-name" {
-			m.Sender = val
-		} else if key == "subscriber" {
-			m.Subscriber = val == "1"
-		} else if key == "badge-info" {
-			// Sub length only exists if they are a sub, ensure it exists
-			if len(val) > 0 {
-				if strings.Split(val, "/")[0] == "subscriber" {
-					subLength, err := strconv.Atoi(strings.Split(val, "/")[1])
-					if err != nil {
-						log.Fatalf("Could not determine sub length: %s\n", err)
-					}
-					m.SubLength = subLength
-				}
-			}
-		} else if key == "mod" {
-			m.Mod = val == "1"
-		} else if key == "user-id" {
-			m.UserID = val
+// Part leaves the channel
+func (c *Chat) Part(channel string) error {
+	channel = normalizeChannel(channel)
+
+	c.mu.Lock()
+	conn, ok := c.channels[channel]
+	delete(c.channels, channel)
+	c.mu.Unlock()
+
+	if !ok {
+		return errors.New(fmt.Sprintf("Not in channel %s", channel))
+	}
+	return conn.part(channel)
+}
+
+// Channels returns the names of every channel the chat has joined or is
+// joining
+func (c *Chat) Channels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	channels := make([]string, 0, len(c.channels))
+	for channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// IsJoined reports whether the server has confirmed joining the channel
+func (c *Chat) IsJoined(channel string) bool {
+	channel = normalizeChannel(channel)
+	c.mu.Lock()
+	conn, ok := c.channels[channel]
+	c.mu.Unlock()
+	return ok && conn.isJoined(channel)
+}
+
+// IsConnected reports whether the chat has authenticated to the server
+func (c *Chat) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		if conn.isConnected() {
+			return true
 		}
 	}
+	return false
+}
 
-	// Get the message
-	m.Text = strings.Split(line, "tmi.twitch.tv PRIVMSG #"+c.Channel+" :")[1]
+// Say sends a message to the channel
+func (c *Chat) Say(text string) error {
+	return c.SayIn(c.Channel, text)
+}
+
+// Reply sends a message to the channel as a threaded reply to the message
+// with the given ID
+func (c *Chat) Reply(parentMsgID string, text string) error {
+	return c.ReplyIn(c.Channel, parentMsgID, text)
+}
+
+// Action sends a message to the channel as an action, the same as typing
+// "/me <text>" in the Twitch chat box
+func (c *Chat) Action(text string) error {
+	return c.ActionIn(c.Channel, text)
+}
 
-	return m
+// SayIn sends a message to one of the joined channels
+func (c *Chat) SayIn(channel string, text string) error {
+	return c.privmsg(channel, nil, text)
+}
+
+// ReplyIn sends a threaded reply to one of the joined channels
+func (c *Chat) ReplyIn(channel string, parentMsgID string, text string) error {
+	return c.privmsg(channel, map[string]string{"reply-parent-msg-id": parentMsgID}, text)
+}
+
+// ActionIn sends an action to one of the joined channels
+func (c *Chat) ActionIn(channel string, text string) error {
+	return c.privmsg(channel, nil, "\x01ACTION "+text+"\x01")
+}
+
+// privmsg queues the message, which is sent as soon as the message rate
+// limits allow
+func (c *Chat) privmsg(channel string, tags map[string]string, text string) error {
+	channel = normalizeChannel(channel)
+	if len(channel) == 0 {
+		return errNoChannel
+	}
+	if _, err := c.connFor(channel); err != nil {
+		return err
+	}
+
+	// Line breaks would end the IRC message early, so flatten them
+	text = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text)
+	c.queue.push(channel, &IRCMessage{
+		Tags:    tags,
+		Command: "PRIVMSG",
+		Params:  []string{"#" + channel, text},
+	})
+	return nil
+}
+
+// QueueLength returns the number of messages waiting to be sent
+func (c *Chat) QueueLength() int {
+	return c.queue.len()
+}
+
+// IsModerator reports whether the logged in user is a moderator, VIP or the
+// broadcaster in the channel, which raises the message rate limits
+func (c *Chat) IsModerator(channel string) bool {
+	return c.queue.isMod(normalizeChannel(channel))
+}
+
+// connFor returns the connection the channel was joined on, falling back to
+// the first connection for channels that haven't been joined
+func (c *Chat) connFor(channel string) (*chatConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return nil, errChatClosed
+	} else if conn, ok := c.channels[channel]; ok {
+		return conn, nil
+	} else if len(c.conns) > 0 {
+		return c.conns[0], nil
+	}
+	return nil, errChatNotConnected
+}
+
+// handleIRCMessage passes messages from any connection on to the registered
+// handlers
+func (c *Chat) handleIRCMessage(msg *IRCMessage) {
+	atomic.AddInt32(&c.inHandler, 1)
+	defer atomic.AddInt32(&c.inHandler, -1)
+	switch msg.Command {
+	case "PRIVMSG":
+		// Read a message in one of the joined channels
+		if handler := c.getHandlers().message; handler != nil {
+			handler(c.parseMessage(msg))
+		}
+	case "USERSTATE":
+		// Our badges in the channel decide which message limits apply
+		c.queue.setMod(msg.Channel(), msg.Tags["mod"] == "1" || isModeratorBadge(msg.Tags["badges"]))
+		c.dispatchEvent(msg)
+	default:
+		c.dispatchEvent(msg)
+	}
 }
@@ -0,0 +1,403 @@
+package twitchgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chatConn is a single connection to the chat server. A Chat opens more of
+// them as it joins more channels than fit on one connection.
+type chatConn struct {
+	chat *Chat
+
+	mu        sync.Mutex
+	transport chatTransport
+	connected bool
+	// channels maps each channel on this connection to whether the server
+	// has confirmed the join
+	channels map[string]bool
+	// serverReconnect is set when the server asked us to reconnect
+	serverReconnect bool
+	// accessToken is the token we logged in with, and authFailed is set
+	// when the server rejected it
+	accessToken string
+	authFailed  bool
+	// authRefreshed is set once the token has been refreshed after a failed
+	// login, so a second failure isn't retried forever
+	authRefreshed bool
+	writeMu       sync.Mutex
+}
+
+var (
+	errServerReconnect = errors.New("server requested a reconnect")
+	errChatAuthFailed  = errors.New("login authentication failed")
+)
+
+// pongTimeout is how long to wait for a reply to our own PING before
+// treating the connection as dead, unless ChatOptions.PingTimeout is shorter
+const pongTimeout = 10 * time.Second
+
+// dialConn opens and authenticates a new connection, it starts reading once
+// passed to startConn
+func (c *Chat) dialConn() (*chatConn, error) {
+	s := &chatConn{chat: c, channels: map[string]bool{}}
+	if err := s.dial(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// startConn adds the connection to the chat and starts reading from it, c.mu
+// must be held
+func (c *Chat) startConn(s *chatConn) {
+	c.conns = append(c.conns, s)
+	c.wg.Add(1)
+	go s.run()
+}
+
+// dial opens the network connection and authenticates. Channels are joined
+// once the server welcomes us.
+func (s *chatConn) dial() error {
+	// Connect to the server
+	transport, err := dialTransport(s.chat.ctx, s.chat.options)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Could not connect to chat server: %v", err))
+	}
+	s.mu.Lock()
+	if err := s.chat.ctx.Err(); err != nil {
+		// The chat was closed while we were dialing
+		s.mu.Unlock()
+		transport.Close()
+		return err
+	}
+	s.transport = transport
+	s.serverReconnect = false
+	s.authFailed = false
+	s.accessToken = s.chat.Twitch.token().AccessToken
+	accessToken := s.accessToken
+	s.mu.Unlock()
+
+	// Authenticate
+	for _, m := range []*IRCMessage{
+		{Command: "CAP", Params: []string{"REQ", "twitch.tv/membership twitch.tv/tags twitch.tv/commands"}},
+		{Command: "PASS", Params: []string{"oauth:" + accessToken}},
+		{Command: "NICK", Params: []string{s.chat.login}},
+	} {
+		if err := s.sendIRC(m); err != nil {
+			transport.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// run reads from the connection for as long as it is open, reconnecting and
+// rejoining every channel whenever it drops
+func (s *chatConn) run() {
+	defer s.chat.wg.Done()
+	for {
+		err := s.readThread()
+
+		s.mu.Lock()
+		s.connected = false
+		for channel := range s.channels {
+			s.channels[channel] = false
+		}
+		if s.serverReconnect {
+			err = errServerReconnect
+		}
+		authFailed, accessToken := s.authFailed, s.accessToken
+		if authFailed {
+			err = errChatAuthFailed
+		}
+		s.transport.Close()
+		s.mu.Unlock()
+
+		// The connection was closed on purpose
+		if s.chat.ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Disconnected from chat server: %s", err)
+		s.chat.emitConnectionState(&ConnectionStateEvent{State: StateDisconnected, Err: err})
+		if authFailed {
+			// The token was rejected, refresh it once before logging in
+			// again
+			if err := s.refreshAuth(accessToken); err != nil {
+				if s.chat.ctx.Err() == nil {
+					s.chat.stop(err)
+				}
+				return
+			}
+		}
+		if err := s.reconnect(); err != nil {
+			if s.chat.ctx.Err() == nil {
+				s.chat.stop(err)
+			}
+			return
+		}
+	}
+}
+
+// refreshAuth refreshes the token the server rejected, giving up if it was
+// already refreshed since the last successful login
+func (s *chatConn) refreshAuth(accessToken string) error {
+	s.mu.Lock()
+	refreshed := s.authRefreshed
+	s.authRefreshed = true
+	s.mu.Unlock()
+	if refreshed {
+		return errors.New("Chat login failed again after refreshing the token")
+	}
+
+	if err := s.chat.Twitch.refreshStaleToken(s.chat.ctx, accessToken); err != nil {
+		return errors.New(fmt.Sprintf("Chat login failed and the token could not be refreshed: %v", err))
+	}
+	return nil
+}
+
+// reconnect dials the server with an exponential backoff until it succeeds,
+// the chat is closed, or ChatOptions.MaxReconnectAttempts is reached
+func (s *chatConn) reconnect() error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		max := s.chat.options.MaxReconnectAttempts
+		if max > 0 && attempt >= max {
+			return errors.New(fmt.Sprintf("Gave up reconnecting to chat after %d attempts: %v", attempt, err))
+		}
+
+		s.chat.emitConnectionState(&ConnectionStateEvent{State: StateReconnecting, Attempt: attempt + 1})
+		select {
+		case <-time.After(s.chat.options.Reconnect.Delay(attempt)):
+		case <-s.chat.ctx.Done():
+			return s.chat.ctx.Err()
+		}
+
+		err = s.dial()
+		if err == nil {
+			return nil
+		}
+		log.Printf("Reconnect attempt %d failed: %s", attempt+1, err)
+	}
+}
+
+// close closes the current transport, run() exits instead of reconnecting
+// once the chat's context is done
+func (s *chatConn) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport != nil {
+		s.transport.Close()
+	}
+}
+
+func (s *chatConn) sendMsg(message string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	transport := s.transport
+	s.mu.Unlock()
+
+	err := transport.WriteLine(message)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error sending message: %v", err))
+	}
+	return nil
+}
+
+func (s *chatConn) sendIRC(m *IRCMessage) error {
+	return s.sendMsg(m.String())
+}
+
+// send encodes an IRC command with its params and writes it to the server,
+// logging any failure
+func (s *chatConn) send(command string, params ...string) {
+	err := s.sendIRC(&IRCMessage{Command: command, Params: params})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// readThread reads and handles lines until the connection fails. If nothing
+// is received for ChatOptions.PingTimeout we send our own PING, and give up
+// on the connection if that goes unanswered too.
+func (s *chatConn) readThread() error {
+	s.mu.Lock()
+	transport := s.transport
+	s.mu.Unlock()
+
+	pingSent := false
+	transport.SetReadDeadline(time.Now().Add(s.chat.options.PingTimeout))
+	for {
+		line, err := transport.ReadLine()
+		if errors.Is(err, os.ErrDeadlineExceeded) && !pingSent {
+			pingSent = true
+			s.send("PING", "tmi.twitch.tv")
+			if s.chat.options.PingTimeout < pongTimeout {
+				transport.SetReadDeadline(time.Now().Add(s.chat.options.PingTimeout))
+			} else {
+				transport.SetReadDeadline(time.Now().Add(pongTimeout))
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		pingSent = false
+		transport.SetReadDeadline(time.Now().Add(s.chat.options.PingTimeout))
+
+		msg, err := ParseIRCMessage(line)
+		if err != nil {
+			log.Printf("Could not parse chat line %q: %s", line, err)
+			continue
+		}
+		s.handleIRCMessage(msg)
+	}
+}
+
+// handleIRCMessage takes care of the connection level commands before
+// passing the message on to the Chat's handlers
+func (s *chatConn) handleIRCMessage(msg *IRCMessage) {
+	switch msg.Command {
+	case "001":
+		// We've authenticated to the server, join every channel that was
+		// requested while connecting
+		s.mu.Lock()
+		s.connected = true
+		s.authRefreshed = false
+		channels := make([]string, 0, len(s.channels))
+		for channel := range s.channels {
+			channels = append(channels, channel)
+		}
+		s.mu.Unlock()
+		s.chat.emitConnectionState(&ConnectionStateEvent{State: StateConnected})
+		go func() {
+			for _, channel := range channels {
+				if err := s.sendJoin(channel); err != nil {
+					return
+				}
+			}
+		}()
+	case "366":
+		// We've joined one of our channels
+		s.mu.Lock()
+		if _, ok := s.channels[msg.Channel()]; ok {
+			s.channels[msg.Channel()] = true
+		}
+		s.mu.Unlock()
+	case "PING":
+		// Respond to Keepalive message
+		s.send("PONG", msg.Params...)
+	case "NOTICE":
+		// Twitch rejects the login with a notice before closing the
+		// connection
+		if msg.Trailing() == "Login authentication failed" || msg.Trailing() == "Improperly formatted auth" {
+			s.mu.Lock()
+			s.authFailed = true
+			s.transport.Close()
+			s.mu.Unlock()
+		}
+	case "RECONNECT":
+		// The server is going away, drop the connection so that run()
+		// reconnects
+		s.mu.Lock()
+		s.serverReconnect = true
+		s.transport.Close()
+		s.mu.Unlock()
+	}
+
+	s.chat.handleIRCMessage(msg)
+}
+
+// join adds the channel to this connection. It reports whether the caller
+// should send the JOIN, otherwise it is sent once the connection has
+// authenticated.
+func (s *chatConn) join(channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[channel] = false
+	return s.connected
+}
+
+func (s *chatConn) sendJoin(channel string) error {
+	if err := s.chat.joinLimiter.wait(s.chat.ctx); err != nil {
+		return err
+	}
+	return s.sendIRC(&IRCMessage{Command: "JOIN", Params: []string{"#" + channel}})
+}
+
+func (s *chatConn) part(channel string) error {
+	s.mu.Lock()
+	delete(s.channels, channel)
+	s.mu.Unlock()
+	return s.sendIRC(&IRCMessage{Command: "PART", Params: []string{"#" + channel}})
+}
+
+func (s *chatConn) channelCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels)
+}
+
+func (s *chatConn) channelNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+func (s *chatConn) isJoined(channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels[channel]
+}
+
+func (s *chatConn) isConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected
+}
+
+// joinLimiter allows at most limit JOINs within any window, blocking
+// callers until there is room
+type joinLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	sent   []time.Time
+}
+
+func (l *joinLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		for len(l.sent) > 0 && now.Sub(l.sent[0]) >= l.window {
+			l.sent = l.sent[1:]
+		}
+		if len(l.sent) < l.limit {
+			l.sent = append(l.sent, now)
+			l.mu.Unlock()
+			return nil
+		}
+		delay := l.window - now.Sub(l.sent[0])
+		l.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func normalizeChannel(channel string) string {
+	return strings.ToLower(strings.TrimPrefix(channel, "#"))
+}
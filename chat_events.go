@@ -0,0 +1,485 @@
+package twitchgo
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SubscriptionEvent is sent when a user subscribes or resubscribes to a channel
+type SubscriptionEvent struct {
+	Channel          string
+	Login            string
+	DisplayName      string
+	UserID           string
+	Resub            bool
+	Plan             string
+	PlanName         string
+	CumulativeMonths int
+	StreakMonths     int
+	Text             string
+	SystemMsg        string
+	Raw              *IRCMessage
+}
+
+// GiftSubscriptionEvent is sent when a user gifts one or more subscriptions.
+// Recipient fields are empty for mystery gifts, where Count holds the
+// number of gifted subs instead.
+type GiftSubscriptionEvent struct {
+	Channel              string
+	GifterLogin          string
+	GifterDisplayName    string
+	GifterUserID         string
+	Anonymous            bool
+	RecipientLogin       string
+	RecipientDisplayName string
+	RecipientUserID      string
+	Plan                 string
+	Months               int
+	Count                int
+	SystemMsg            string
+	Raw                  *IRCMessage
+}
+
+// RaidEvent is sent when another broadcaster raids the channel
+type RaidEvent struct {
+	Channel     string
+	Login       string
+	DisplayName string
+	UserID      string
+	ViewerCount int
+	SystemMsg   string
+	Raw         *IRCMessage
+}
+
+// UserNoticeEvent is sent for any USERNOTICE, including those without a
+// dedicated event type such as announcements or bits badge tiers
+type UserNoticeEvent struct {
+	Channel     string
+	MsgID       string
+	Login       string
+	DisplayName string
+	UserID      string
+	Text        string
+	SystemMsg   string
+	Raw         *IRCMessage
+}
+
+// BanEvent is sent when a user is permanently banned from the channel
+type BanEvent struct {
+	Channel      string
+	RoomID       string
+	TargetLogin  string
+	TargetUserID string
+	Raw          *IRCMessage
+}
+
+// TimeoutEvent is sent when a user is timed out in the channel
+type TimeoutEvent struct {
+	Channel      string
+	RoomID       string
+	TargetLogin  string
+	TargetUserID string
+	Duration     time.Duration
+	Raw          *IRCMessage
+}
+
+// ClearChatEvent is sent when all messages in the channel are cleared
+type ClearChatEvent struct {
+	Channel string
+	RoomID  string
+	Raw     *IRCMessage
+}
+
+// MessageDeletedEvent is sent when a single message is deleted
+type MessageDeletedEvent struct {
+	Channel   string
+	Login     string
+	MessageID string
+	Text      string
+	Raw       *IRCMessage
+}
+
+// RoomStateEvent is sent when joining a channel and whenever one of its chat
+// settings changes. Updates only carry the settings that changed, check Raw.Tags
+// to see which ones are present.
+type RoomStateEvent struct {
+	Channel       string
+	RoomID        string
+	EmoteOnly     bool
+	FollowersOnly int
+	R9K           bool
+	Slow          int
+	SubsOnly      bool
+	Raw           *IRCMessage
+}
+
+// UserStateEvent is sent when joining a channel or sending a message, and
+// describes the logged in user in that channel
+type UserStateEvent struct {
+	Channel     string
+	DisplayName string
+	Color       string
+	Mod         bool
+	Subscriber  bool
+	EmoteSets   []string
+	Raw         *IRCMessage
+}
+
+// GlobalUserStateEvent is sent after authenticating and describes the
+// logged in user
+type GlobalUserStateEvent struct {
+	UserID      string
+	DisplayName string
+	Color       string
+	EmoteSets   []string
+	Raw         *IRCMessage
+}
+
+// HostTargetEvent is sent when the channel starts or stops hosting another
+// channel. Target is empty when hosting stopped.
+type HostTargetEvent struct {
+	Channel string
+	Target  string
+	Viewers int
+	Raw     *IRCMessage
+}
+
+// NoticeEvent is sent for server notices, such as failed commands or
+// authentication errors
+type NoticeEvent struct {
+	Channel string
+	MsgID   string
+	Text    string
+	Raw     *IRCMessage
+}
+
+// ReconnectEvent is sent when the server is about to restart. The chat
+// reconnects on its own, the event is only informational.
+type ReconnectEvent struct {
+	Raw *IRCMessage
+}
+
+// ConnectionState is the state of one of the chat's connections
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota
+	StateReconnecting
+	StateConnected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateConnected:
+		return "connected"
+	}
+	return "unknown"
+}
+
+// ConnectionStateEvent is sent whenever a chat connection is established,
+// drops, or tries to reconnect. Err holds the reason the connection dropped
+// and Attempt counts reconnect attempts since then.
+type ConnectionStateEvent struct {
+	State   ConnectionState
+	Err     error
+	Attempt int
+}
+
+type chatHandlers struct {
+	message          func(*Message)
+	subscription     func(*SubscriptionEvent)
+	giftSubscription func(*GiftSubscriptionEvent)
+	raid             func(*RaidEvent)
+	userNotice       func(*UserNoticeEvent)
+	ban              func(*BanEvent)
+	timeout          func(*TimeoutEvent)
+	clearChat        func(*ClearChatEvent)
+	messageDeleted   func(*MessageDeletedEvent)
+	roomState        func(*RoomStateEvent)
+	userState        func(*UserStateEvent)
+	globalUserState  func(*GlobalUserStateEvent)
+	hostTarget       func(*HostTargetEvent)
+	notice           func(*NoticeEvent)
+	reconnect        func(*ReconnectEvent)
+	connectionState  func(*ConnectionStateEvent)
+}
+
+// OnMessage registers the handler called for every chat message
+func (c *Chat) OnMessage(handler func(*Message)) {
+	c.setHandler(func(h *chatHandlers) { h.message = handler })
+}
+
+// OnSubscription registers the handler called for subs and resubs
+func (c *Chat) OnSubscription(handler func(*SubscriptionEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.subscription = handler })
+}
+
+// OnGiftSubscription registers the handler called for gifted subs
+func (c *Chat) OnGiftSubscription(handler func(*GiftSubscriptionEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.giftSubscription = handler })
+}
+
+// OnRaid registers the handler called when the channel is raided
+func (c *Chat) OnRaid(handler func(*RaidEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.raid = handler })
+}
+
+// OnUserNotice registers the handler called for every USERNOTICE
+func (c *Chat) OnUserNotice(handler func(*UserNoticeEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.userNotice = handler })
+}
+
+// OnBan registers the handler called when a user is banned
+func (c *Chat) OnBan(handler func(*BanEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.ban = handler })
+}
+
+// OnTimeout registers the handler called when a user is timed out
+func (c *Chat) OnTimeout(handler func(*TimeoutEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.timeout = handler })
+}
+
+// OnClearChat registers the handler called when the whole chat is cleared
+func (c *Chat) OnClearChat(handler func(*ClearChatEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.clearChat = handler })
+}
+
+// OnMessageDeleted registers the handler called when a message is deleted
+func (c *Chat) OnMessageDeleted(handler func(*MessageDeletedEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.messageDeleted = handler })
+}
+
+// OnRoomState registers the handler called when the channel settings change
+func (c *Chat) OnRoomState(handler func(*RoomStateEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.roomState = handler })
+}
+
+// OnUserState registers the handler called with the logged in user's state
+// in the channel
+func (c *Chat) OnUserState(handler func(*UserStateEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.userState = handler })
+}
+
+// OnGlobalUserState registers the handler called with the logged in user's
+// global state
+func (c *Chat) OnGlobalUserState(handler func(*GlobalUserStateEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.globalUserState = handler })
+}
+
+// OnHostTarget registers the handler called when the channel hosts another
+func (c *Chat) OnHostTarget(handler func(*HostTargetEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.hostTarget = handler })
+}
+
+// OnNotice registers the handler called for server notices
+func (c *Chat) OnNotice(handler func(*NoticeEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.notice = handler })
+}
+
+// OnReconnect registers the handler called when the server asks the client
+// to reconnect
+func (c *Chat) OnReconnect(handler func(*ReconnectEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.reconnect = handler })
+}
+
+// OnConnectionState registers the handler called when a connection is
+// established, drops or is reconnecting
+func (c *Chat) OnConnectionState(handler func(*ConnectionStateEvent)) {
+	c.setHandler(func(h *chatHandlers) { h.connectionState = handler })
+}
+
+func (c *Chat) emitConnectionState(e *ConnectionStateEvent) {
+	atomic.AddInt32(&c.inHandler, 1)
+	defer atomic.AddInt32(&c.inHandler, -1)
+	if handler := c.getHandlers().connectionState; handler != nil {
+		handler(e)
+	}
+}
+
+func (c *Chat) setHandler(set func(*chatHandlers)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	set(&c.handlers)
+}
+
+// getHandlers returns a copy of the registered handlers, so they can be called
+// without holding the lock
+func (c *Chat) getHandlers() chatHandlers {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+	return c.handlers
+}
+
+// dispatchEvent converts the IRC message into its typed event, if it has
+// one, and calls the registered handler
+func (c *Chat) dispatchEvent(msg *IRCMessage) {
+	h := c.getHandlers()
+	switch msg.Command {
+	case "USERNOTICE":
+		c.dispatchUserNotice(msg)
+	case "CLEARCHAT":
+		duration, hasDuration := msg.Tags["ban-duration"]
+		if len(msg.Params) < 2 {
+			if h.clearChat != nil {
+				h.clearChat(&ClearChatEvent{msg.Channel(), msg.Tags["room-id"], msg})
+			}
+		} else if hasDuration {
+			if h.timeout != nil {
+				seconds, _ := strconv.Atoi(duration)
+				h.timeout(&TimeoutEvent{msg.Channel(), msg.Tags["room-id"], msg.Trailing(), msg.Tags["target-user-id"], time.Duration(seconds) * time.Second, msg})
+			}
+		} else if h.ban != nil {
+			h.ban(&BanEvent{msg.Channel(), msg.Tags["room-id"], msg.Trailing(), msg.Tags["target-user-id"], msg})
+		}
+	case "CLEARMSG":
+		if h.messageDeleted != nil {
+			h.messageDeleted(&MessageDeletedEvent{msg.Channel(), msg.Tags["login"], msg.Tags["target-msg-id"], msg.Trailing(), msg})
+		}
+	case "ROOMSTATE":
+		if h.roomState != nil {
+			h.roomState(&RoomStateEvent{
+				Channel:       msg.Channel(),
+				RoomID:        msg.Tags["room-id"],
+				EmoteOnly:     msg.Tags["emote-only"] == "1",
+				FollowersOnly: tagInt(msg, "followers-only", -1),
+				R9K:           msg.Tags["r9k"] == "1",
+				Slow:          tagInt(msg, "slow", 0),
+				SubsOnly:      msg.Tags["subs-only"] == "1",
+				Raw:           msg,
+			})
+		}
+	case "USERSTATE":
+		if h.userState != nil {
+			h.userState(&UserStateEvent{
+				Channel:     msg.Channel(),
+				DisplayName: msg.Tags["display-name"],
+				Color:       msg.Tags["color"],
+				Mod:         msg.Tags["mod"] == "1",
+				Subscriber:  msg.Tags["subscriber"] == "1",
+				EmoteSets:   tagList(msg, "emote-sets"),
+				Raw:         msg,
+			})
+		}
+	case "GLOBALUSERSTATE":
+		if h.globalUserState != nil {
+			h.globalUserState(&GlobalUserStateEvent{msg.Tags["user-id"], msg.Tags["display-name"], msg.Tags["color"], tagList(msg, "emote-sets"), msg})
+		}
+	case "HOSTTARGET":
+		if h.hostTarget != nil {
+			// The trailing param is "<target> <viewers>", with "-" as the
+			// target when hosting stops
+			target, viewers, _ := strings.Cut(msg.Trailing(), " ")
+			if target == "-" {
+				target = ""
+			}
+			viewerCount, _ := strconv.Atoi(viewers)
+			h.hostTarget(&HostTargetEvent{msg.Channel(), target, viewerCount, msg})
+		}
+	case "NOTICE":
+		if h.notice != nil {
+			h.notice(&NoticeEvent{msg.Channel(), msg.Tags["msg-id"], msg.Trailing(), msg})
+		}
+	case "RECONNECT":
+		if h.reconnect != nil {
+			h.reconnect(&ReconnectEvent{msg})
+		}
+	}
+}
+
+func (c *Chat) dispatchUserNotice(msg *IRCMessage) {
+	h := c.getHandlers()
+	msgID := msg.Tags["msg-id"]
+
+	// USERNOTICE messages only carry text when the user added one
+	text := ""
+	if len(msg.Params) > 1 {
+		text = msg.Trailing()
+	}
+
+	switch msgID {
+	case "sub", "resub":
+		if h.subscription != nil {
+			h.subscription(&SubscriptionEvent{
+				Channel:          msg.Channel(),
+				Login:            msg.Tags["login"],
+				DisplayName:      msg.Tags["display-name"],
+				UserID:           msg.Tags["user-id"],
+				Resub:            msgID == "resub",
+				Plan:             msg.Tags["msg-param-sub-plan"],
+				PlanName:         msg.Tags["msg-param-sub-plan-name"],
+				CumulativeMonths: tagInt(msg, "msg-param-cumulative-months", 0),
+				StreakMonths:     tagInt(msg, "msg-param-streak-months", 0),
+				Text:             text,
+				SystemMsg:        msg.Tags["system-msg"],
+				Raw:              msg,
+			})
+		}
+	case "subgift", "anonsubgift", "submysterygift", "anonsubmysterygift":
+		if h.giftSubscription != nil {
+			h.giftSubscription(&GiftSubscriptionEvent{
+				Channel:              msg.Channel(),
+				GifterLogin:          msg.Tags["login"],
+				GifterDisplayName:    msg.Tags["display-name"],
+				GifterUserID:         msg.Tags["user-id"],
+				Anonymous:            strings.HasPrefix(msgID, "anon") || msg.Tags["login"] == "ananonymousgifter",
+				RecipientLogin:       msg.Tags["msg-param-recipient-user-name"],
+				RecipientDisplayName: msg.Tags["msg-param-recipient-display-name"],
+				RecipientUserID:      msg.Tags["msg-param-recipient-id"],
+				Plan:                 msg.Tags["msg-param-sub-plan"],
+				Months:               tagInt(msg, "msg-param-months", 0),
+				Count:                tagInt(msg, "msg-param-mass-gift-count", 1),
+				SystemMsg:            msg.Tags["system-msg"],
+				Raw:                  msg,
+			})
+		}
+	case "raid":
+		if h.raid != nil {
+			h.raid(&RaidEvent{
+				Channel:     msg.Channel(),
+				Login:       msg.Tags["msg-param-login"],
+				DisplayName: msg.Tags["msg-param-displayName"],
+				UserID:      msg.Tags["user-id"],
+				ViewerCount: tagInt(msg, "msg-param-viewerCount", 0),
+				SystemMsg:   msg.Tags["system-msg"],
+				Raw:         msg,
+			})
+		}
+	}
+
+	if h.userNotice != nil {
+		h.userNotice(&UserNoticeEvent{
+			Channel:     msg.Channel(),
+			MsgID:       msgID,
+			Login:       msg.Tags["login"],
+			DisplayName: msg.Tags["display-name"],
+			UserID:      msg.Tags["user-id"],
+			Text:        text,
+			SystemMsg:   msg.Tags["system-msg"],
+			Raw:         msg,
+		})
+	}
+}
+
+// tagInt returns the integer value of a tag, or def if it is missing or
+// isn't a number
+func tagInt(msg *IRCMessage, key string, def int) int {
+	i, err := strconv.Atoi(msg.Tags[key])
+	if err != nil {
+		return def
+	}
+	return i
+}
+
+// tagList splits a comma separated tag value
+func tagList(msg *IRCMessage, key string) []string {
+	if len(msg.Tags[key]) == 0 {
+		return nil
+	}
+	return strings.Split(msg.Tags[key], ",")
+}
@@ -0,0 +1,236 @@
+package twitchgo
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// messageWindow is the window Twitch measures the chat message limits over
+const messageWindow = 30 * time.Second
+
+// duplicateWindow is how long Twitch rejects a repeat of the previous message
+// in a channel from a user that isn't a moderator
+const duplicateWindow = 30 * time.Second
+
+// minMessageGap is the minimum time between two messages to the same channel
+// from a user that isn't a moderator
+const minMessageGap = time.Second
+
+// duplicateSuffix is appended to a repeated message so Twitch doesn't drop
+// it as a duplicate. It is an invisible tag character.
+const duplicateSuffix = " \U000E0000"
+
+// sendWindow allows at most limit messages within any window, remembering
+// when each recent message was sent
+type sendWindow struct {
+	limit  int
+	window time.Duration
+	sent   []time.Time
+}
+
+func newSendWindow(limit int, window time.Duration) *sendWindow {
+	return &sendWindow{limit: limit, window: window}
+}
+
+// delay returns how long until another message fits in the window
+func (w *sendWindow) delay(now time.Time) time.Duration {
+	for len(w.sent) > 0 && now.Sub(w.sent[0]) >= w.window {
+		w.sent = w.sent[1:]
+	}
+	if len(w.sent) < w.limit {
+		return 0
+	}
+	return w.window - now.Sub(w.sent[0])
+}
+
+func (w *sendWindow) take(now time.Time) {
+	w.sent = append(w.sent, now)
+}
+
+type queuedMessage struct {
+	channel string
+	msg     *IRCMessage
+}
+
+type sentMessage struct {
+	at   time.Time
+	text string
+}
+
+// sendQueue paces outgoing chat messages to stay within Twitch's limits.
+// Every message counts towards the moderator limit, and messages to channels
+// where we aren't a moderator also count towards the lower user limit.
+type sendQueue struct {
+	chat *Chat
+
+	mu         sync.Mutex
+	queue      []queuedMessage
+	wake       chan struct{}
+	userWindow *sendWindow
+	modWindow  *sendWindow
+	mods       map[string]bool
+	lastSent   map[string]sentMessage
+}
+
+func newSendQueue(c *Chat) *sendQueue {
+	return &sendQueue{
+		chat:       c,
+		wake:       make(chan struct{}, 1),
+		userWindow: newSendWindow(c.options.MessageLimit, messageWindow),
+		modWindow:  newSendWindow(c.options.ModMessageLimit, messageWindow),
+		mods:       map[string]bool{},
+		lastSent:   map[string]sentMessage{},
+	}
+}
+
+func (q *sendQueue) push(channel string, msg *IRCMessage) {
+	q.mu.Lock()
+	q.queue = append(q.queue, queuedMessage{channel, msg})
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue)
+}
+
+func (q *sendQueue) setMod(channel string, mod bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.mods[channel] = mod
+}
+
+func (q *sendQueue) isMod(channel string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.mods[channel]
+}
+
+// run sends queued messages as fast as the limits allow until the chat stops
+func (q *sendQueue) run() {
+	defer q.chat.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		m, delay, ok := q.next(time.Now())
+		if !ok {
+			delay = time.Hour
+		}
+		if !ok || delay > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(delay)
+			select {
+			case <-timer.C:
+			case <-q.wake:
+			case <-q.chat.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		conn, err := q.chat.connFor(m.channel)
+		if err == nil {
+			err = conn.sendIRC(m.msg)
+		}
+		if err != nil {
+			log.Printf("Error sending message to %s: %s", m.channel, err)
+		}
+	}
+}
+
+// next pops the first queued message that may be sent now, otherwise it
+// reports how long until one can be. Messages to the same channel keep their
+// order, but a channel that has to wait doesn't hold up the others.
+func (q *sendQueue) next(now time.Time) (queuedMessage, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.queue) == 0 {
+		return queuedMessage{}, 0, false
+	}
+
+	// Every message counts towards the moderator limit
+	if delay := q.modWindow.delay(now); delay > 0 {
+		return q.queue[0], delay, true
+	}
+
+	var wait time.Duration
+	waiting := map[string]bool{}
+	for i, m := range q.queue {
+		if waiting[m.channel] {
+			continue
+		}
+		if delay := q.channelDelay(m.channel, now); delay > 0 {
+			waiting[m.channel] = true
+			if wait == 0 || delay < wait {
+				wait = delay
+			}
+			continue
+		}
+
+		q.queue = append(q.queue[:i:i], q.queue[i+1:]...)
+		q.send(m, now)
+		return m, 0, true
+	}
+	return q.queue[0], wait, true
+}
+
+// channelDelay returns how long until a message may be sent to the channel,
+// ignoring the moderator limit. q.mu must be held.
+func (q *sendQueue) channelDelay(channel string, now time.Time) time.Duration {
+	if q.mods[channel] {
+		return 0
+	}
+	delay := q.userWindow.delay(now)
+	if last, ok := q.lastSent[channel]; ok {
+		if d := minMessageGap - now.Sub(last.at); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// send records the message as sent against the limits. q.mu must be held.
+func (q *sendQueue) send(m queuedMessage, now time.Time) {
+	q.modWindow.take(now)
+	if !q.mods[m.channel] {
+		q.userWindow.take(now)
+
+		// Twitch drops a repeat of the previous message, so make it differ
+		last, sentBefore := q.lastSent[m.channel]
+		text := m.msg.Trailing()
+		if sentBefore && now.Sub(last.at) < duplicateWindow && text == last.text {
+			if strings.HasSuffix(text, duplicateSuffix) {
+				text = strings.TrimSuffix(text, duplicateSuffix)
+			} else {
+				text += duplicateSuffix
+			}
+			m.msg.Params[len(m.msg.Params)-1] = text
+		}
+	}
+	q.lastSent[m.channel] = sentMessage{now, m.msg.Trailing()}
+}
+
+// isModeratorBadge reports whether the USERSTATE badges give us the
+// moderator rate limits in the channel
+func isModeratorBadge(badges string) bool {
+	for _, badge := range strings.Split(badges, ",") {
+		name, _, _ := strings.Cut(badge, "/")
+		if name == "moderator" || name == "broadcaster" || name == "vip" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,732 @@
+package twitchgo
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseMessage(t *testing.T) {
+	line := "@badge-info=subscriber/14,predictions/blue-1;badges=subscriber/12,premium/1;display-name=Some=User;mod=1;subscriber=1;user-id=5678 :someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :hello = world"
+	irc, err := ParseIRCMessage(line)
+	if err != nil {
+		t.Fatalf(`ParseIRCMessage(line) = got error: %s`, err)
+	}
+
+	c := &Chat{Channel: "channel"}
+	m := c.parseMessage(irc)
+
+	if m.Sender != "Some=User" {
+		t.Fatalf(`parseMessage() Sender = got %s, want Some=User`, m.Sender)
+	} else if m.Text != "hello = world" {
+		t.Fatalf(`parseMessage() Text = got %s, want hello = world`, m.Text)
+	} else if m.Channel != "channel" {
+		t.Fatalf(`parseMessage() Channel = got %s, want channel`, m.Channel)
+	} else if !m.Subscriber || !m.Mod {
+		t.Fatalf(`parseMessage() Subscriber/Mod = got %t/%t, want true/true`, m.Subscriber, m.Mod)
+	} else if m.SubLength != 14 {
+		t.Fatalf(`parseMessage() SubLength = got %d, want 14`, m.SubLength)
+	} else if m.UserID != "5678" {
+		t.Fatalf(`parseMessage() UserID = got %s, want 5678`, m.UserID)
+	}
+}
+
+func TestDispatchEvents(t *testing.T) {
+	c := &Chat{Channel: "channel"}
+
+	var sub *SubscriptionEvent
+	var gift *GiftSubscriptionEvent
+	var raid *RaidEvent
+	var ban *BanEvent
+	var timeout *TimeoutEvent
+	var deleted *MessageDeletedEvent
+	var roomState *RoomStateEvent
+	notices := 0
+	c.OnSubscription(func(e *SubscriptionEvent) { sub = e })
+	c.OnGiftSubscription(func(e *GiftSubscriptionEvent) { gift = e })
+	c.OnRaid(func(e *RaidEvent) { raid = e })
+	c.OnBan(func(e *BanEvent) { ban = e })
+	c.OnTimeout(func(e *TimeoutEvent) { timeout = e })
+	c.OnMessageDeleted(func(e *MessageDeletedEvent) { deleted = e })
+	c.OnRoomState(func(e *RoomStateEvent) { roomState = e })
+	c.OnUserNotice(func(e *UserNoticeEvent) { notices++ })
+
+	lines := []string{
+		"@display-name=Sub;login=sub;msg-id=resub;msg-param-cumulative-months=6;msg-param-sub-plan=1000;system-msg=Sub\\ssubscribed;user-id=1 :tmi.twitch.tv USERNOTICE #channel :Great stream",
+		"@login=gifter;msg-id=subgift;msg-param-recipient-user-name=lucky;msg-param-months=1;msg-param-sub-plan=2000;user-id=2 :tmi.twitch.tv USERNOTICE #channel",
+		"@msg-id=raid;msg-param-displayName=Raider;msg-param-login=raider;msg-param-viewerCount=42;user-id=3 :tmi.twitch.tv USERNOTICE #channel",
+		"@room-id=10;target-user-id=4 :tmi.twitch.tv CLEARCHAT #channel :banned",
+		"@ban-duration=600;room-id=10;target-user-id=5 :tmi.twitch.tv CLEARCHAT #channel :timedout",
+		"@login=someone;target-msg-id=abc-123 :tmi.twitch.tv CLEARMSG #channel :bad words",
+		"@emote-only=0;followers-only=10;r9k=0;room-id=10;slow=30;subs-only=1 :tmi.twitch.tv ROOMSTATE #channel",
+	}
+	for _, line := range lines {
+		msg, err := ParseIRCMessage(line)
+		if err != nil {
+			t.Fatalf(`ParseIRCMessage(%q) = got error: %s`, line, err)
+		}
+		c.handleIRCMessage(msg)
+	}
+
+	if sub == nil || !sub.Resub || sub.CumulativeMonths != 6 || sub.Text != "Great stream" || sub.SystemMsg != "Sub subscribed" {
+		t.Fatalf(`dispatchEvent() SubscriptionEvent = got %+v`, sub)
+	} else if gift == nil || gift.RecipientLogin != "lucky" || gift.Plan != "2000" || gift.Count != 1 {
+		t.Fatalf(`dispatchEvent() GiftSubscriptionEvent = got %+v`, gift)
+	} else if raid == nil || raid.Login != "raider" || raid.ViewerCount != 42 {
+		t.Fatalf(`dispatchEvent() RaidEvent = got %+v`, raid)
+	} else if ban == nil || ban.TargetLogin != "banned" || ban.TargetUserID != "4" {
+		t.Fatalf(`dispatchEvent() BanEvent = got %+v`, ban)
+	} else if timeout == nil || timeout.TargetLogin != "timedout" || timeout.Duration != 10*time.Minute {
+		t.Fatalf(`dispatchEvent() TimeoutEvent = got %+v`, timeout)
+	} else if deleted == nil || deleted.MessageID != "abc-123" || deleted.Text != "bad words" {
+		t.Fatalf(`dispatchEvent() MessageDeletedEvent = got %+v`, deleted)
+	} else if roomState == nil || roomState.FollowersOnly != 10 || roomState.Slow != 30 || !roomState.SubsOnly {
+		t.Fatalf(`dispatchEvent() RoomStateEvent = got %+v`, roomState)
+	} else if notices != 3 {
+		t.Fatalf(`dispatchEvent() UserNoticeEvent count = got %d, want 3`, notices)
+	}
+}
+
+func TestSendMessages(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	c := NewTwitch(&Configuration{}).NewChat("Channel")
+	c.conns = []*chatConn{{chat: c, transport: &tcpTransport{conn: client, reader: bufio.NewReader(client)}, channels: map[string]bool{}}}
+	c.queue.setMod("channel", true)
+	c.wg.Add(1)
+	go c.queue.run()
+	defer c.stop(nil)
+
+	go func() {
+		c.Say("hello\r\nPRIVMSG #other :injected")
+		c.Reply("abc-123", "hi back")
+		c.Action("waves")
+	}()
+
+	want := []string{
+		"PRIVMSG #channel :hello PRIVMSG #other :injected",
+		"@reply-parent-msg-id=abc-123 PRIVMSG #channel :hi back",
+		"PRIVMSG #channel :\x01ACTION waves\x01",
+	}
+	reader := bufio.NewReader(server)
+	for _, w := range want {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf(`Say() = got error: %s`, err)
+		}
+		if line != w+"\r\n" {
+			t.Fatalf(`Say() = got %q, want %q`, line, w+"\r\n")
+		}
+	}
+}
+
+func TestJoinShardsChannels(t *testing.T) {
+	c := NewTwitch(&Configuration{}).NewChatWithOptions("", ChatOptions{MaxChannelsPerConnection: 2})
+	for i := 0; i < 2; i++ {
+		c.conns = append(c.conns, &chatConn{chat: c, channels: map[string]bool{}})
+	}
+
+	for _, channel := range []string{"#One", "two", "three", "two"} {
+		if err := c.Join(channel); err != nil {
+			t.Fatalf(`Join(%s) = got error: %s`, channel, err)
+		}
+	}
+
+	want := []string{"one", "three", "two"}
+	if got := c.Channels(); !reflect.DeepEqual(got, want) {
+		t.Fatalf(`Channels() = got %v, want %v`, got, want)
+	} else if c.conns[0].channelCount() != 2 || c.conns[1].channelCount() != 1 {
+		t.Fatalf(`Join() channels per connection = got %d/%d, want 2/1`, c.conns[0].channelCount(), c.conns[1].channelCount())
+	}
+}
+
+func TestJoinDialsWithoutLocking(t *testing.T) {
+	// The listener never accepts, so the TLS handshake of the new connection
+	// hangs until the chat is stopped
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() = got error: %s`, err)
+	}
+	defer listener.Close()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	c := newTestTwitch(t).NewChatWithOptions("", ChatOptions{Host: host, Port: portNum, MaxChannelsPerConnection: 1})
+	c.conns = []*chatConn{{chat: c, channels: map[string]bool{"one": true}}}
+	c.channels["one"] = c.conns[0]
+
+	joined := make(chan error, 1)
+	go func() { joined <- c.Join("two") }()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan []string, 1)
+	go func() { done <- c.Channels() }()
+	select {
+	case got := <-done:
+		if want := []string{"one"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf(`Channels() = got %v, want %v`, got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Channels() = blocked while Join() was dialing`)
+	}
+
+	c.stop(nil)
+	select {
+	case err := <-joined:
+		if err == nil {
+			t.Fatalf(`Join() after stop = got no error`)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Join() = did not return after stop`)
+	}
+}
+
+func TestSayWithoutChannel(t *testing.T) {
+	c := NewTwitch(&Configuration{}).NewChat("")
+	c.conns = []*chatConn{{chat: c, channels: map[string]bool{}}}
+
+	if err := c.Say("hello"); err == nil {
+		t.Fatalf(`Say() without a channel = got no error`)
+	} else if err := c.ActionIn("#", "waves"); err == nil {
+		t.Fatalf(`ActionIn("#") = got no error`)
+	} else if err := c.Join(""); err == nil {
+		t.Fatalf(`Join("") = got no error`)
+	} else if c.QueueLength() != 0 {
+		t.Fatalf(`QueueLength() = got %d, want 0`, c.QueueLength())
+	}
+}
+
+func TestJoinLimiter(t *testing.T) {
+	l := &joinLimiter{limit: 2, window: 50 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		l.wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf(`joinLimiter.wait() = got 3 joins in %s, want at least 50ms`, elapsed)
+	}
+}
+
+func TestReadThreadPingTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := NewTwitch(&Configuration{}).NewChatWithOptions("", ChatOptions{PingTimeout: 20 * time.Millisecond})
+	s := &chatConn{chat: c, transport: &tcpTransport{conn: client, reader: bufio.NewReader(client)}, channels: map[string]bool{}}
+
+	errs := make(chan error)
+	go func() {
+		errs <- s.readThread()
+	}()
+
+	// The client should check the idle connection with a PING of its own
+	line, err := bufio.NewReader(server).ReadString('\n')
+	if err != nil {
+		t.Fatalf(`readThread() = got error: %s`, err)
+	} else if line != "PING tmi.twitch.tv\r\n" {
+		t.Fatalf(`readThread() = got %q, want PING`, line)
+	}
+
+	// And give up when it goes unanswered
+	select {
+	case err := <-errs:
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			t.Fatalf(`readThread() = got %v, want timeout`, err)
+		}
+	case <-time.After(2 * pongTimeout):
+		t.Fatalf(`readThread() = did not time out`)
+	}
+}
+
+func TestHandlersArePerChat(t *testing.T) {
+	twitch := NewTwitch(&Configuration{})
+	msg, _ := ParseIRCMessage("@display-name=Someone :someone!someone@someone.tmi.twitch.tv PRIVMSG #channel :hi")
+
+	var got1, got2 int
+	c1 := twitch.NewChat("channel")
+	c1.OnMessage(func(m *Message) { got1++ })
+	c2 := twitch.NewChat("channel")
+	c2.OnMessage(func(m *Message) { got2++ })
+
+	c1.handleIRCMessage(msg)
+	c1.handleIRCMessage(msg)
+	c2.handleIRCMessage(msg)
+
+	if got1 != 2 || got2 != 1 {
+		t.Fatalf(`handleIRCMessage() handler calls = got %d/%d, want 2/1`, got1, got2)
+	}
+}
+
+// fakeChatServer accepts chat connections on a local port so the full
+// connect, join and reconnect flow can be tested
+type fakeChatServer struct {
+	listener net.Listener
+	conns    chan *fakeChatConn
+}
+
+type fakeChatConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newFakeChatServer(t *testing.T, listener net.Listener) *fakeChatServer {
+	f := &fakeChatServer{listener, make(chan *fakeChatConn, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Finish the TLS handshake right away, as the client's dial
+			// blocks on it
+			if tlsConn, ok := conn.(*tls.Conn); ok {
+				tlsConn.Handshake()
+			}
+			f.conns <- &fakeChatConn{conn, bufio.NewReader(conn)}
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return f
+}
+
+func (f *fakeChatServer) accept(t *testing.T) *fakeChatConn {
+	select {
+	case conn := <-f.conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`fakeChatServer = no connection received`)
+	}
+	return nil
+}
+
+func (f *fakeChatConn) expect(t *testing.T, want string) {
+	f.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := f.reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf(`fakeChatConn.expect(%q) = got error: %s`, want, err)
+	} else if line != want+"\r\n" {
+		t.Fatalf(`fakeChatConn.expect() = got %q, want %q`, line, want+"\r\n")
+	}
+}
+
+func (f *fakeChatConn) send(line string) {
+	f.conn.Write([]byte(line + "\r\n"))
+}
+
+// newTestTwitch returns a client whose API always reports the logged in user
+// as "bot"
+func newTestTwitch(t *testing.T) *Twitch {
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"data": [{"id": "1", "login": "bot", "display_name": "Bot"}]}`)
+		}))
+	t.Cleanup(svr.Close)
+
+	twitch := NewTwitch(&Configuration{Token: Token{AccessToken: "token"}})
+	twitch.BaseApiUrl = svr.URL
+	return twitch
+}
+
+func (f *fakeChatConn) expectLogin(t *testing.T) {
+	f.expect(t, "CAP REQ :twitch.tv/membership twitch.tv/tags twitch.tv/commands")
+	f.expect(t, "PASS oauth:token")
+	f.expect(t, "NICK bot")
+	f.send(":tmi.twitch.tv 001 bot :Welcome, GLHF!")
+}
+
+func TestChatConnectAndReconnect(t *testing.T) {
+	// Serve chat over TLS using the httptest certificate
+	tlsSvr := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsSvr.Close()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsSvr.TLS)
+	if err != nil {
+		t.Fatalf(`tls.Listen() = got error: %s`, err)
+	}
+	server := newFakeChatServer(t, listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	chat := newTestTwitch(t).NewChatWithOptions("Channel", ChatOptions{
+		Host:      host,
+		Port:      portNum,
+		TLSConfig: tlsSvr.Client().Transport.(*http.Transport).TLSClientConfig,
+		Reconnect: Backoff{Min: time.Millisecond, Max: time.Millisecond},
+	})
+	messages := make(chan *Message, 1)
+	chat.OnMessage(func(m *Message) { messages <- m })
+	states := make(chan ConnectionState, 10)
+	chat.OnConnectionState(func(e *ConnectionStateEvent) { states <- e.State })
+
+	if err := chat.Connect(context.Background()); err != nil {
+		t.Fatalf(`Connect() = got error: %s`, err)
+	}
+	conn := server.accept(t)
+	conn.expectLogin(t)
+	conn.expect(t, "JOIN #channel")
+	conn.send("@display-name=Viewer :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :hello")
+
+	select {
+	case m := <-messages:
+		if m.Sender != "Viewer" || m.Text != "hello" {
+			t.Fatalf(`OnMessage() = got %+v`, m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`OnMessage() = no message received`)
+	}
+
+	// Ask the client to reconnect, it should log in and rejoin the channel
+	conn.send(":tmi.twitch.tv RECONNECT")
+	conn = server.accept(t)
+	conn.expectLogin(t)
+	conn.expect(t, "JOIN #channel")
+
+	wantStates := []ConnectionState{StateConnected, StateDisconnected, StateReconnecting, StateConnected}
+	for _, want := range wantStates {
+		if got := <-states; got != want {
+			t.Fatalf(`OnConnectionState() = got %s, want %s`, got, want)
+		}
+	}
+
+	// Closing should leave the channel and stop without reconnecting
+	go chat.Close()
+	conn.expect(t, "PART #channel")
+	conn.expect(t, "QUIT")
+	if err := chat.Wait(); err != nil {
+		t.Fatalf(`Wait() = got error: %s`, err)
+	}
+	select {
+	case state := <-states:
+		t.Fatalf(`OnConnectionState() after Close() = got %s`, state)
+	default:
+	}
+}
+
+func TestChatContextCancel(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() = got error: %s`, err)
+	}
+	server := newFakeChatServer(t, listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	chat := newTestTwitch(t).NewChatWithOptions("", ChatOptions{Host: host, Port: portNum, DisableTLS: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := chat.Connect(ctx); err != nil {
+		t.Fatalf(`Connect() = got error: %s`, err)
+	}
+	server.accept(t).expectLogin(t)
+
+	cancel()
+	select {
+	case <-chat.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Done() = not closed after cancelling the context`)
+	}
+	if err := chat.Wait(); err != context.Canceled {
+		t.Fatalf(`Wait() = got %v, want %v`, err, context.Canceled)
+	} else if err := chat.Join("channel"); err == nil {
+		t.Fatalf(`Join() after cancel = got no error`)
+	} else if err := chat.Close(); err != context.Canceled {
+		t.Fatalf(`Close() after cancel = got %v, want %v`, err, context.Canceled)
+	}
+}
+
+func TestChatCloseFromHandler(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() = got error: %s`, err)
+	}
+	server := newFakeChatServer(t, listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	chat := newTestTwitch(t).NewChatWithOptions("channel", ChatOptions{Host: host, Port: portNum, DisableTLS: true})
+	closed := make(chan error, 1)
+	chat.OnMessage(func(m *Message) { closed <- chat.Close() })
+
+	if err := chat.Connect(context.Background()); err != nil {
+		t.Fatalf(`Connect() = got error: %s`, err)
+	}
+	conn := server.accept(t)
+	conn.expectLogin(t)
+	conn.expect(t, "JOIN #channel")
+	conn.send(":viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :!quit")
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf(`Close() = got error: %s`, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Close() = did not return when called from a handler`)
+	}
+	select {
+	case <-chat.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Done() = not closed after Close()`)
+	}
+}
+
+func TestChatCloseWaits(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() = got error: %s`, err)
+	}
+	server := newFakeChatServer(t, listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	chat := newTestTwitch(t).NewChatWithOptions("channel", ChatOptions{Host: host, Port: portNum, DisableTLS: true})
+	if err := chat.Connect(context.Background()); err != nil {
+		t.Fatalf(`Connect() = got error: %s`, err)
+	}
+	conn := server.accept(t)
+	conn.expectLogin(t)
+	conn.expect(t, "JOIN #channel")
+
+	if err := chat.Close(); err != nil {
+		t.Fatalf(`Close() = got error: %s`, err)
+	}
+	select {
+	case <-chat.Done():
+	default:
+		t.Fatalf(`Done() = not closed when Close() returned`)
+	}
+	conn.expect(t, "PART #channel")
+	conn.expect(t, "QUIT")
+
+	// Failing to say goodbye is reported
+	client, peer := net.Pipe()
+	peer.Close()
+	c := NewTwitch(&Configuration{}).NewChat("channel")
+	c.conns = []*chatConn{{chat: c, transport: &tcpTransport{conn: client, reader: bufio.NewReader(client)}, channels: map[string]bool{"channel": true}}}
+	if err := c.Close(); err == nil {
+		t.Fatalf(`Close() = got no error when the PART couldn't be sent`)
+	}
+}
+
+func TestChatConnectFailureStops(t *testing.T) {
+	// Nothing is listening on the port once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() = got error: %s`, err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	listener.Close()
+
+	chat := newTestTwitch(t).NewChatWithOptions("channel", ChatOptions{Host: host, Port: portNum, DisableTLS: true})
+	if err = chat.Connect(context.Background()); err == nil {
+		t.Fatalf(`Connect() = got no error, want the dial failure`)
+	}
+	select {
+	case <-chat.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Done() = not closed after Connect() failed`)
+	}
+	if err := chat.Wait(); err == nil {
+		t.Fatalf(`Wait() = got no error, want the dial failure`)
+	}
+
+	// The chat also stops when looking up the logged in user fails
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+	defer svr.Close()
+	twitch := NewTwitch(&Configuration{Token: Token{AccessToken: "token"}})
+	twitch.BaseApiUrl = svr.URL
+	chat, err = twitch.ChatConnect(context.Background(), "channel", func(*Message) {})
+	if err == nil {
+		t.Fatalf(`ChatConnect() = got no error, want the API failure`)
+	}
+	select {
+	case <-chat.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Done() = not closed after ChatConnect() failed`)
+	}
+}
+
+func TestSendQueueLimits(t *testing.T) {
+	c := NewTwitch(&Configuration{}).NewChatWithOptions("", ChatOptions{MessageLimit: 2, ModMessageLimit: 3})
+	q := c.queue
+	now := time.Now()
+	privmsg := func(channel, text string) *IRCMessage {
+		return &IRCMessage{Command: "PRIVMSG", Params: []string{"#" + channel, text}}
+	}
+
+	q.push("user", privmsg("user", "hello"))
+	q.push("user", privmsg("user", "hello"))
+	q.push("user", privmsg("user", "again"))
+
+	if _, delay, _ := q.next(now); delay != 0 {
+		t.Fatalf(`next() first message delay = got %s, want 0`, delay)
+	}
+	// Non moderators must wait a second between messages to a channel
+	if _, delay, _ := q.next(now); delay != minMessageGap {
+		t.Fatalf(`next() second message delay = got %s, want %s`, delay, minMessageGap)
+	}
+	m, delay, _ := q.next(now.Add(minMessageGap))
+	if delay != 0 {
+		t.Fatalf(`next() second message delay = got %s, want 0`, delay)
+	} else if m.msg.Trailing() != "hello"+duplicateSuffix {
+		t.Fatalf(`next() duplicate message = got %q, want suffix added`, m.msg.Trailing())
+	}
+	// Both user messages were sent within the last 30 seconds, so the third
+	// waits for the first to leave the window
+	if _, delay, _ := q.next(now.Add(2 * time.Second)); delay < 10*time.Second {
+		t.Fatalf(`next() third message delay = got %s, want at least 10s`, delay)
+	} else if q.len() != 1 {
+		t.Fatalf(`len() = got %d, want 1`, q.len())
+	}
+
+	// Moderators skip the user limits but still count towards the total
+	q.queue = nil
+	q.setMod("modded", true)
+	q.push("modded", privmsg("modded", "one"))
+	q.push("modded", privmsg("modded", "two"))
+	if _, delay, _ := q.next(now.Add(2 * time.Second)); delay != 0 {
+		t.Fatalf(`next() moderator message delay = got %s, want 0`, delay)
+	} else if _, delay, _ := q.next(now.Add(2 * time.Second)); delay == 0 {
+		t.Fatalf(`next() moderator message over total limit = got no delay`)
+	}
+}
+
+func TestSendQueueWindow(t *testing.T) {
+	c := NewTwitch(&Configuration{}).NewChatWithOptions("", ChatOptions{MessageLimit: 20})
+	q := c.queue
+	for i := 0; i < 100; i++ {
+		channel := fmt.Sprintf("channel%d", i%5)
+		q.push(channel, &IRCMessage{Command: "PRIVMSG", Params: []string{"#" + channel, fmt.Sprintf("message %d", i)}})
+	}
+
+	// Send everything as soon as the queue allows
+	var sent []time.Time
+	now := time.Now()
+	for q.len() > 0 {
+		_, delay, _ := q.next(now)
+		if delay > 0 {
+			now = now.Add(delay)
+			continue
+		}
+		sent = append(sent, now)
+	}
+
+	// No 30 second window may hold more than the limit
+	for i := range sent {
+		count := 0
+		for _, at := range sent[i:] {
+			if at.Sub(sent[i]) < messageWindow {
+				count++
+			}
+		}
+		if count > 20 {
+			t.Fatalf(`next() = sent %d messages in the 30s after message %d, want at most 20`, count, i)
+		}
+	}
+}
+
+func TestSendQueueChannelsDontBlock(t *testing.T) {
+	c := NewTwitch(&Configuration{}).NewChat("")
+	q := c.queue
+	now := time.Now()
+	q.setMod("modded", true)
+	q.push("user", &IRCMessage{Command: "PRIVMSG", Params: []string{"#user", "one"}})
+	q.push("user", &IRCMessage{Command: "PRIVMSG", Params: []string{"#user", "two"}})
+	q.push("modded", &IRCMessage{Command: "PRIVMSG", Params: []string{"#modded", "three"}})
+	q.push("user", &IRCMessage{Command: "PRIVMSG", Params: []string{"#user", "four"}})
+
+	// The second message to the user channel has to wait a second, which
+	// shouldn't hold up the moderated channel
+	want := []string{"one", "three"}
+	for _, w := range want {
+		m, delay, _ := q.next(now)
+		if delay != 0 || m.msg.Trailing() != w {
+			t.Fatalf(`next() = got %q after %s, want %q now`, m.msg.Trailing(), delay, w)
+		}
+	}
+	if _, delay, _ := q.next(now); delay != minMessageGap {
+		t.Fatalf(`next() = got delay %s, want %s`, delay, minMessageGap)
+	}
+	if m, _, _ := q.next(now.Add(minMessageGap)); m.msg.Trailing() != "two" {
+		t.Fatalf(`next() = got %q, want the user channel messages in order`, m.msg.Trailing())
+	}
+}
+
+func TestUserStateSetsModerator(t *testing.T) {
+	c := NewTwitch(&Configuration{}).NewChat("channel")
+	msg, _ := ParseIRCMessage("@badges=moderator/1,subscriber/12;mod=1 :tmi.twitch.tv USERSTATE #channel")
+	c.handleIRCMessage(msg)
+	if !c.IsModerator("#Channel") {
+		t.Fatalf(`IsModerator() = got false, want true`)
+	}
+}
+
+func TestChatRefreshesRejectedToken(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf(`net.Listen() = got error: %s`, err)
+	}
+	server := newFakeChatServer(t, listener)
+
+	// Set up the token endpoint the rejected token is refreshed with
+	refreshes := 0
+	authSvr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			refreshes++
+			fmt.Fprint(w, `{"access_token": "newtoken", "refresh_token": "newrefresh", "expires_in": 14400}`)
+		}))
+	defer authSvr.Close()
+
+	twitch := newTestTwitch(t)
+	twitch.config.Token.RefreshToken = "refresh"
+	twitch.BaseAuthUrl = authSvr.URL
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	chat := twitch.NewChatWithOptions("", ChatOptions{
+		Host:       host,
+		Port:       portNum,
+		DisableTLS: true,
+		Reconnect:  Backoff{Min: time.Millisecond, Max: time.Millisecond},
+	})
+	if err := chat.Connect(context.Background()); err != nil {
+		t.Fatalf(`Connect() = got error: %s`, err)
+	}
+	defer chat.Close()
+
+	// Reject the first login, the client should log in again with a new token
+	conn := server.accept(t)
+	conn.expect(t, "CAP REQ :twitch.tv/membership twitch.tv/tags twitch.tv/commands")
+	conn.expect(t, "PASS oauth:token")
+	conn.expect(t, "NICK bot")
+	conn.send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+
+	conn = server.accept(t)
+	conn.expect(t, "CAP REQ :twitch.tv/membership twitch.tv/tags twitch.tv/commands")
+	conn.expect(t, "PASS oauth:newtoken")
+	if refreshes != 1 {
+		t.Fatalf(`refreshes = got %d, want 1`, refreshes)
+	}
+
+	// A second rejection straight after refreshing stops the chat
+	conn.send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+	select {
+	case <-chat.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Done() = not closed after the login failed twice`)
+	}
+	if err := chat.Wait(); err == nil {
+		t.Fatalf(`Wait() = got no error, want the login failure`)
+	}
+}
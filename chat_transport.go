@@ -0,0 +1,90 @@
+package twitchgo
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ChatTransport selects how a Chat reaches the chat server
+type ChatTransport int
+
+const (
+	// TransportTCP speaks IRC over a TCP connection, using TLS unless
+	// ChatOptions.DisableTLS is set
+	TransportTCP ChatTransport = iota
+	// TransportWebSocket speaks IRC over a WebSocket, which works through
+	// HTTP proxies that block raw TCP
+	TransportWebSocket
+)
+
+// chatTransport carries IRC lines to and from the chat server
+type chatTransport interface {
+	// ReadLine returns the next line without its CRLF. When the read
+	// deadline passes it returns an error wrapping os.ErrDeadlineExceeded,
+	// after which reading can continue.
+	ReadLine() (string, error)
+	WriteLine(line string) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+func dialTransport(ctx context.Context, options ChatOptions) (chatTransport, error) {
+	if options.Transport == TransportWebSocket {
+		return dialWebSocket(ctx, options.WebSocketURL, options.TLSConfig, options.Proxy)
+	}
+
+	addr := net.JoinHostPort(options.Host, strconv.Itoa(options.Port))
+	var conn net.Conn
+	var err error
+	if options.DisableTLS {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&tls.Dialer{Config: options.TLSConfig}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tcpTransport{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// tcpTransport sends IRC lines directly over a TCP or TLS connection
+type tcpTransport struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// partial holds the start of a line that was cut off by a read deadline
+	partial string
+}
+
+func (t *tcpTransport) ReadLine() (string, error) {
+	line, err := t.reader.ReadString('\n')
+	t.partial += line
+	if err != nil {
+		return "", err
+	}
+	line, t.partial = t.partial, ""
+	return trimCRLF(line), nil
+}
+
+func (t *tcpTransport) WriteLine(line string) error {
+	_, err := t.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+func (t *tcpTransport) SetReadDeadline(deadline time.Time) error {
+	return t.conn.SetReadDeadline(deadline)
+}
+
+func (t *tcpTransport) Close() error {
+	return t.conn.Close()
+}
+
+func trimCRLF(line string) string {
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+		line = line[:len(line)-1]
+	}
+	return line
+}
@@ -2,10 +2,13 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 
 	"github.com/brianmmcclain/twitchgo"
@@ -52,9 +55,24 @@ func main() {
 
 	fmt.Printf("Connecting to %s . . .\n", streams[in-1].UserName)
 
-	twitchConn.ChatConnect(streams[in-1].UserLogin, chatHandler)
+	// Disconnect on Ctrl+C, or when enter is pressed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	fmt.Scanln()
+	chat, err := twitchConn.ChatConnect(ctx, streams[in-1].UserLogin, chatHandler)
+	if err != nil {
+		log.Fatalf("Error connecting to chat: %s", err)
+	}
+
+	go func() {
+		fmt.Scanln()
+		chat.Close()
+	}()
+
+	err = chat.Wait()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Chat stopped: %s", err)
+	}
 }
 
 func chatHandler(m *twitchgo.Message) {
@@ -2,6 +2,8 @@ package twitchgo
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -13,7 +15,13 @@ type Configuration struct {
 	ClientSecret string `json:"client_secret"`
 	Auth         string `json:"auth"`
 	Token        Token  `json:"token"`
-	path         string
+	// AppToken is the app access token from the client credentials, used by
+	// requests that don't need a user
+	AppToken Token `json:"app_token"`
+	// Scopes are requested on top of the ones the client always needs. If
+	// the saved token lacks any of them, Auth asks the user to log in again.
+	Scopes []Scope `json:"scopes,omitempty"`
+	path   string
 }
 
 type Token struct {
@@ -21,6 +29,8 @@ type Token struct {
 	Expires      time.Time
 	ExpiresIn    int    `json:"expires_in"`
 	RefreshToken string `json:"refresh_token"`
+	// Scope lists the scopes the user granted
+	Scope []string `json:"scope"`
 }
 
 func LoadConfig(configPath string) *Configuration {
@@ -46,24 +56,23 @@ func ParseConfig(configJSON string) (*Configuration, error) {
 	return c, nil
 }
 
-func (c *Configuration) WriteConfig(path string) {
+// WriteConfig saves the config as JSON to path
+func (c *Configuration) WriteConfig(path string) error {
 	j, err := json.Marshal(c)
 	if err != nil {
-		log.Fatalf("Error marshaling config: %s", err)
+		return errors.New(fmt.Sprintf("Error marshaling config: %v", err))
 	}
 
-	log.Printf("%s\n", j)
-
 	// Open config
-	f, err := os.OpenFile(c.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
-		log.Fatalf("Error opening config at %s: %s", c.path, err)
+		return errors.New(fmt.Sprintf("Error opening config at %s: %v", path, err))
 	}
+	defer f.Close()
 
 	// Write config
-	_, err = f.Write(j)
-	if err != nil {
-		log.Fatalf("Error writing config: %s", err)
+	if _, err := f.Write(j); err != nil {
+		return errors.New(fmt.Sprintf("Error writing config: %v", err))
 	}
-	f.Close()
+	return nil
 }
@@ -1,7 +1,12 @@
 package twitchgo
 
 import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -21,3 +26,35 @@ func TestParseConfig(t *testing.T) {
 		t.Fatalf(`ParseConfig(configJSON) = got %s, want %s`, c.ClientSecret, wantSecret)
 	}
 }
+
+func TestWriteConfig(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	c := &Configuration{ClientID: "MyID", ClientSecret: "MySecret", Token: Token{AccessToken: "access"}}
+	if err := c.WriteConfig(path); err != nil {
+		t.Fatalf(`WriteConfig() = got error: %s`, err)
+	} else if saved := LoadConfig(path); saved.ClientSecret != "MySecret" || saved.Token.AccessToken != "access" {
+		t.Fatalf(`WriteConfig() saved = got %s/%s, want MySecret/access`, saved.ClientSecret, saved.Token.AccessToken)
+	} else if strings.Contains(logs.String(), "MySecret") {
+		t.Fatalf(`WriteConfig() = logged the client secret: %s`, logs.String())
+	}
+
+	// A config that can't be written is reported instead of exiting
+	if err := c.WriteConfig(dir); err == nil {
+		t.Fatalf(`WriteConfig(dir) = got no error`)
+	}
+
+	// A token is still used when it can't be saved
+	twitch := NewTwitch(c)
+	c.path = filepath.Join(dir, "missing", "config.json")
+	twitch.setToken(Token{AccessToken: "new"})
+	if got := twitch.token().AccessToken; got != "new" {
+		t.Fatalf(`setToken() = got %s, want new`, got)
+	} else if !strings.Contains(logs.String(), "Could not save the new token") {
+		t.Fatalf(`setToken() = got logs %q, want the save error`, logs.String())
+	}
+}
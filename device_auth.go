@@ -0,0 +1,140 @@
+package twitchgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// deviceSlowDown is added to the polling interval each time Twitch asks us to
+// slow down
+const deviceSlowDown = 5 * time.Second
+
+// devicePollInterval is used when the device code doesn't give an interval
+var devicePollInterval = 5 * time.Second
+
+var errDeviceCodeExpired = errors.New("device code expired before it was authorized")
+
+// DeviceCode is what the user needs to authorize a device, from the Device
+// Code Grant flow
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	// ExpiresIn is how many seconds the user has to enter the code
+	ExpiresIn int `json:"expires_in"`
+	// Interval is how many seconds to wait between polls for the token
+	Interval int `json:"interval"`
+	Expires  time.Time
+}
+
+// AuthDevice logs in with the Device Code Grant flow, for machines without a
+// browser. Unless the saved token can be used or refreshed, it logs a URL and
+// code to enter on any other device and waits until the user has done so.
+func (t *Twitch) AuthDevice(ctx context.Context) error {
+	ok, err := t.reuseToken(ctx)
+	if err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
+	code, err := t.RequestDeviceCode(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Please authenticate by visiting %s and entering the code %s\n", code.VerificationURI, code.UserCode)
+	return t.PollDeviceToken(ctx, code)
+}
+
+// RequestDeviceCode starts the Device Code Grant flow
+func (t *Twitch) RequestDeviceCode(ctx context.Context) (*DeviceCode, error) {
+	data := url.Values{
+		"client_id": {t.config.ClientID},
+		"scopes":    {t.scopeParam()},
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "POST", t.BaseAuthUrl+"/device", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error requesting device code: %v", err))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error reading device code response: %v", err))
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, respBody)
+	}
+
+	code := new(DeviceCode)
+	if err := json.Unmarshal(respBody, &code); err != nil {
+		return nil, errors.New(fmt.Sprintf("Error parsing device code response: %v", err))
+	}
+	code.Expires = time.Now().Add(time.Second * time.Duration(code.ExpiresIn))
+	return code, nil
+}
+
+// PollDeviceToken waits for the user to authorize the device code, then
+// stores the token in the config
+func (t *Twitch) PollDeviceToken(ctx context.Context, code *DeviceCode) error {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = devicePollInterval
+	}
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !code.Expires.IsZero() && time.Now().After(code.Expires) {
+			return errDeviceCodeExpired
+		}
+
+		token, err := t.postToken(ctx, url.Values{
+			"client_id":   {t.config.ClientID},
+			"scopes":      {t.scopeParam()},
+			"device_code": {code.DeviceCode},
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		})
+		if err == nil {
+			t.setToken(*token)
+			return nil
+		}
+
+		var retry bool
+		interval, retry = nextDevicePoll(interval, err)
+		if !retry {
+			return err
+		}
+	}
+}
+
+// nextDevicePoll reports whether polling should go on after the error, and
+// the interval to use from now on
+func nextDevicePoll(interval time.Duration, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return interval, false
+	}
+	switch apiErr.Message {
+	case "authorization_pending":
+		// The user hasn't entered the code yet
+		return interval, true
+	case "slow_down":
+		return interval + deviceSlowDown, true
+	}
+	return interval, false
+}
@@ -0,0 +1,96 @@
+package twitchgo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthDevice(t *testing.T) {
+	// Set up the test server, reporting the code as pending twice
+	polls := 0
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			switch r.URL.Path {
+			case "/device":
+				fmt.Fprint(w, `{"device_code": "dev123", "expires_in": 1800, "interval": 0, "user_code": "ABCDEFGH", "verification_uri": "https://www.twitch.tv/activate?public=true&device-code=ABCDEFGH"}`)
+			case "/token":
+				if r.PostForm.Get("device_code") != "dev123" || r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:device_code" {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"status": 400, "message": "invalid device code"}`)
+					return
+				}
+				polls++
+				if polls < 3 {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"status": 400, "message": "authorization_pending"}`)
+					return
+				}
+				fmt.Fprint(w, `{"access_token": "access", "refresh_token": "refresh", "expires_in": 14400}`)
+			}
+		}))
+	defer svr.Close()
+
+	// The code has no interval, so the default one is used between polls
+	defer func(interval time.Duration) { devicePollInterval = interval }(devicePollInterval)
+	devicePollInterval = 20 * time.Millisecond
+
+	twitch := NewTwitch(&Configuration{ClientID: "MyID"})
+	twitch.BaseAuthUrl = svr.URL
+	start := time.Now()
+	if err := twitch.AuthDevice(context.Background()); err != nil {
+		t.Fatalf(`AuthDevice() = got error %s, want nil`, err)
+	} else if elapsed := time.Since(start); elapsed < 3*devicePollInterval {
+		t.Fatalf(`AuthDevice() = took %s, want at least %s between 3 polls`, elapsed, 3*devicePollInterval)
+	} else if polls != 3 {
+		t.Fatalf(`AuthDevice() polls = got %d, want 3`, polls)
+	} else if token := twitch.token(); token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Fatalf(`AuthDevice() token = got %s/%s, want access/refresh`, token.AccessToken, token.RefreshToken)
+	}
+
+	// A rejected device code stops polling
+	err := twitch.PollDeviceToken(context.Background(), &DeviceCode{DeviceCode: "wrong"})
+	if err == nil {
+		t.Fatalf(`PollDeviceToken() = got no error for an invalid code`)
+	}
+}
+
+func TestRefreshDeviceToken(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if _, ok := r.PostForm["client_secret"]; ok {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"status": 400, "message": "Invalid client secret"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "newaccess", "refresh_token": "newrefresh", "expires_in": 14400}`)
+		}))
+	defer svr.Close()
+
+	// A public client has no secret, so none is sent with the refresh
+	twitch := NewTwitch(&Configuration{ClientID: "MyID", Token: Token{AccessToken: "access", RefreshToken: "refresh"}})
+	twitch.BaseAuthUrl = svr.URL
+	if err := twitch.RefreshToken(context.Background()); err != nil {
+		t.Fatalf(`RefreshToken() = got error %s, want nil`, err)
+	} else if got := twitch.token().AccessToken; got != "newaccess" {
+		t.Fatalf(`RefreshToken() token = got %s, want newaccess`, got)
+	}
+}
+
+func TestNextDevicePoll(t *testing.T) {
+	pending := &APIError{StatusCode: http.StatusBadRequest, Message: "authorization_pending"}
+	slowDown := &APIError{StatusCode: http.StatusBadRequest, Message: "slow_down"}
+
+	if interval, retry := nextDevicePoll(5*time.Second, pending); !retry || interval != 5*time.Second {
+		t.Fatalf(`nextDevicePoll(authorization_pending) = got %s/%t, want 5s/true`, interval, retry)
+	} else if interval, retry := nextDevicePoll(5*time.Second, slowDown); !retry || interval != 10*time.Second {
+		t.Fatalf(`nextDevicePoll(slow_down) = got %s/%t, want 10s/true`, interval, retry)
+	} else if _, retry := nextDevicePoll(5*time.Second, errDeviceCodeExpired); retry {
+		t.Fatalf(`nextDevicePoll(other error) = got retry, want none`)
+	}
+}
@@ -0,0 +1,70 @@
+package twitchgo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors an *APIError matches with errors.Is, by HTTP status
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// APIError is returned when Helix answers with an error status
+type APIError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// ErrorName and Message are the error and message fields of the body
+	// Twitch sends with the error, such as Unauthorized and Invalid OAuth token
+	ErrorName string `json:"error"`
+	Message   string `json:"message"`
+	// URL is the URL of the failed request
+	URL string
+	// RateLimit is the state of the rate limit bucket after the request
+	RateLimit RateLimit
+}
+
+// newAPIError builds an error from the status, headers and body of a failed
+// response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		URL:        resp.Request.URL.String(),
+		RateLimit:  parseRateLimit(resp.Header),
+	}
+	json.Unmarshal(body, e)
+	if len(e.ErrorName) == 0 {
+		e.ErrorName = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("Twitch API error %d %s from %s", e.StatusCode, e.ErrorName, e.URL)
+	}
+	return fmt.Sprintf("Twitch API error %d %s from %s: %s", e.StatusCode, e.ErrorName, e.URL, e.Message)
+}
+
+// Is lets errors.Is match the error against the sentinel for its status
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusTooManyRequests:
+		return target == ErrRateLimited
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package twitchgo_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brianmmcclain/twitchgo"
+)
+
+func TestAPIError(t *testing.T) {
+	const TEST_NAME = "APIError"
+
+	// Set up the test server
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Ratelimit-Limit", "800")
+			w.Header().Set("Ratelimit-Remaining", "799")
+			w.Header().Set("Ratelimit-Reset", "1700000000")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "Unauthorized", "status": 401, "message": "Invalid OAuth token"}`)
+		}))
+	defer svr.Close()
+
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c)
+	twitchConn.BaseApiUrl = svr.URL
+	_, err := twitchConn.GetUserByLogin("testUser")
+
+	var apiErr *twitchgo.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf(`GetUserByLogin() = got error %v, want *APIError`, err)
+	}
+	verify(errors.Is(err, twitchgo.ErrUnauthorized), true, TEST_NAME, "IsUnauthorized", t)
+	verify(errors.Is(err, twitchgo.ErrNotFound), false, TEST_NAME, "IsNotFound", t)
+	verify(apiErr.StatusCode, 401, TEST_NAME, "StatusCode", t)
+	verify(apiErr.ErrorName, "Unauthorized", TEST_NAME, "ErrorName", t)
+	verify(apiErr.Message, "Invalid OAuth token", TEST_NAME, "Message", t)
+	verify(apiErr.URL, svr.URL+"/users?login=testUser", TEST_NAME, "URL", t)
+	verify(apiErr.RateLimit.Limit, 800, TEST_NAME, "RateLimit.Limit", t)
+	verify(apiErr.RateLimit.Remaining, 799, TEST_NAME, "RateLimit.Remaining", t)
+	verify(apiErr.RateLimit.Reset.Unix(), int64(1700000000), TEST_NAME, "RateLimit.Reset", t)
+}
+
+func TestGetUserByLoginNotFound(t *testing.T) {
+	// Unknown logins come back as an empty list rather than an error status
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"data": []}`)
+		}))
+	defer svr.Close()
+
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c)
+	twitchConn.BaseApiUrl = svr.URL
+	_, err := twitchConn.GetUserByLogin("nobody")
+	if !errors.Is(err, twitchgo.ErrNotFound) {
+		t.Fatalf(`GetUserByLogin() = got error %v, want ErrNotFound`, err)
+	}
+}
@@ -0,0 +1,203 @@
+package twitchgo
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// IRCMessage is a single IRCv3 message as sent or received on the chat
+// connection. The last element of Params holds the trailing parameter, if any.
+type IRCMessage struct {
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+var (
+	errEmptyIRCCommand   = errors.New("irc message has no command")
+	errInvalidIRCCommand = errors.New("irc message command must be alphanumeric")
+	errInvalidIRCLine    = errors.New("irc message contains CR, LF or NUL")
+)
+
+// ParseIRCMessage parses a raw IRC line, including any IRCv3 tags, into an
+// IRCMessage. Tag values are unescaped.
+func ParseIRCMessage(line string) (*IRCMessage, error) {
+	m := &IRCMessage{Tags: map[string]string{}}
+	line = strings.TrimLeft(strings.TrimRight(line, "\r\n"), " ")
+	if strings.ContainsAny(line, "\r\n\x00") {
+		return nil, errInvalidIRCLine
+	}
+
+	// Tags
+	if strings.HasPrefix(line, "@") {
+		var rawTags string
+		rawTags, line = cutSpace(line[1:])
+		for _, tag := range strings.Split(rawTags, ";") {
+			key, val, _ := strings.Cut(tag, "=")
+			if len(key) == 0 {
+				continue
+			}
+			m.Tags[key] = unescapeTagValue(val)
+		}
+	}
+
+	// Prefix
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, ":") {
+		m.Prefix, line = cutSpace(line[1:])
+	}
+
+	// Command
+	m.Command, line = cutSpace(line)
+	if len(m.Command) == 0 {
+		return nil, errEmptyIRCCommand
+	} else if strings.IndexFunc(m.Command, isNotAlphanumeric) >= 0 {
+		return nil, errInvalidIRCCommand
+	}
+
+	// Params, where everything after a leading ':' is the trailing param
+	for len(line) > 0 {
+		if strings.HasPrefix(line, ":") {
+			m.Params = append(m.Params, line[1:])
+			break
+		}
+		var param string
+		param, line = cutSpace(line)
+		m.Params = append(m.Params, param)
+	}
+
+	return m, nil
+}
+
+// cutSpace splits s around the first space, dropping any extra spaces
+// before the remainder.
+func cutSpace(s string) (string, string) {
+	s = strings.TrimLeft(s, " ")
+	before, after, _ := strings.Cut(s, " ")
+	return before, strings.TrimLeft(after, " ")
+}
+
+func isNotAlphanumeric(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+}
+
+// String encodes the message as a raw IRC line without the trailing CRLF.
+func (m *IRCMessage) String() string {
+	var b strings.Builder
+
+	if len(m.Tags) > 0 {
+		keys := make([]string, 0, len(m.Tags))
+		for k := range m.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteByte('@')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(';')
+			}
+			b.WriteString(k)
+			b.WriteByte('=')
+			b.WriteString(escapeTagValue(m.Tags[k]))
+		}
+		b.WriteByte(' ')
+	}
+
+	if len(m.Prefix) > 0 {
+		b.WriteByte(':')
+		b.WriteString(m.Prefix)
+		b.WriteByte(' ')
+	}
+
+	b.WriteString(m.Command)
+
+	for i, p := range m.Params {
+		b.WriteByte(' ')
+		if i == len(m.Params)-1 && (len(p) == 0 || strings.HasPrefix(p, ":") || strings.Contains(p, " ")) {
+			b.WriteByte(':')
+		}
+		b.WriteString(p)
+	}
+
+	return b.String()
+}
+
+// Param returns the i-th parameter, or an empty string if there is none
+func (m *IRCMessage) Param(i int) string {
+	if i < 0 || i >= len(m.Params) {
+		return ""
+	}
+	return m.Params[i]
+}
+
+// Trailing returns the last parameter of the message, which for PRIVMSG and
+// similar commands holds the message text
+func (m *IRCMessage) Trailing() string {
+	return m.Param(len(m.Params) - 1)
+}
+
+// Nick returns the nickname portion of the message prefix
+func (m *IRCMessage) Nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	nick, _, _ = strings.Cut(nick, "@")
+	return nick
+}
+
+// Channel returns the channel name, without the leading '#', that the
+// message was sent to, or an empty string if it isn't addressed to a channel
+func (m *IRCMessage) Channel() string {
+	for _, p := range m.Params {
+		if strings.HasPrefix(p, "#") {
+			return p[1:]
+		}
+	}
+	return ""
+}
+
+var tagUnescaper = map[byte]byte{
+	':':  ';',
+	's':  ' ',
+	'\\': '\\',
+	'r':  '\r',
+	'n':  '\n',
+}
+
+func unescapeTagValue(val string) string {
+	if !strings.Contains(val, "\\") {
+		return val
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(val); i++ {
+		if val[i] != '\\' {
+			b.WriteByte(val[i])
+			continue
+		}
+		// A lone trailing backslash is dropped
+		i++
+		if i == len(val) {
+			break
+		}
+		if r, ok := tagUnescaper[val[i]]; ok {
+			b.WriteByte(r)
+		} else {
+			b.WriteByte(val[i])
+		}
+	}
+	return b.String()
+}
+
+var tagEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\:",
+	" ", "\\s",
+	"\r", "\\r",
+	"\n", "\\n",
+)
+
+func escapeTagValue(val string) string {
+	return tagEscaper.Replace(val)
+}
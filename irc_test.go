@@ -0,0 +1,105 @@
+package twitchgo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIRCMessage(t *testing.T) {
+	line := "@badge-info=subscriber/12;display-name=Some\\sUser;emotes=;msg-param=a=b\\:c;user-id=1234 :someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :hello :) world\r\n"
+	m, err := ParseIRCMessage(line)
+	if err != nil {
+		t.Fatalf(`ParseIRCMessage(line) = got error: %s`, err)
+	}
+
+	wantTags := map[string]string{
+		"badge-info":   "subscriber/12",
+		"display-name": "Some User",
+		"emotes":       "",
+		"msg-param":    "a=b;c",
+		"user-id":      "1234",
+	}
+	wantParams := []string{"#channel", "hello :) world"}
+
+	if !reflect.DeepEqual(m.Tags, wantTags) {
+		t.Fatalf(`ParseIRCMessage(line) Tags = got %v, want %v`, m.Tags, wantTags)
+	} else if m.Prefix != "someuser!someuser@someuser.tmi.twitch.tv" {
+		t.Fatalf(`ParseIRCMessage(line) Prefix = got %s`, m.Prefix)
+	} else if m.Nick() != "someuser" {
+		t.Fatalf(`ParseIRCMessage(line) Nick() = got %s, want someuser`, m.Nick())
+	} else if m.Command != "PRIVMSG" {
+		t.Fatalf(`ParseIRCMessage(line) Command = got %s, want PRIVMSG`, m.Command)
+	} else if !reflect.DeepEqual(m.Params, wantParams) {
+		t.Fatalf(`ParseIRCMessage(line) Params = got %q, want %q`, m.Params, wantParams)
+	} else if m.Channel() != "channel" {
+		t.Fatalf(`ParseIRCMessage(line) Channel() = got %s, want channel`, m.Channel())
+	}
+}
+
+func TestParseIRCMessageVariants(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantCmd    string
+		wantParams []string
+	}{
+		{"PING :tmi.twitch.tv", "PING", []string{"tmi.twitch.tv"}},
+		{":tmi.twitch.tv 001 user :Welcome, GLHF!", "001", []string{"user", "Welcome, GLHF!"}},
+		{":tmi.twitch.tv CAP * ACK :twitch.tv/tags twitch.tv/commands", "CAP", []string{"*", "ACK", "twitch.tv/tags twitch.tv/commands"}},
+		{":tmi.twitch.tv RECONNECT", "RECONNECT", nil},
+		{"@emote-only=0 :tmi.twitch.tv ROOMSTATE   #channel", "ROOMSTATE", []string{"#channel"}},
+		{":tmi.twitch.tv CLEARCHAT #channel :", "CLEARCHAT", []string{"#channel", ""}},
+	}
+
+	for _, tt := range tests {
+		m, err := ParseIRCMessage(tt.line)
+		if err != nil {
+			t.Fatalf(`ParseIRCMessage(%q) = got error: %s`, tt.line, err)
+		}
+		if m.Command != tt.wantCmd {
+			t.Fatalf(`ParseIRCMessage(%q) Command = got %s, want %s`, tt.line, m.Command, tt.wantCmd)
+		} else if !reflect.DeepEqual(m.Params, tt.wantParams) {
+			t.Fatalf(`ParseIRCMessage(%q) Params = got %q, want %q`, tt.line, m.Params, tt.wantParams)
+		}
+	}
+
+	for _, line := range []string{"", "@a=b", ":prefix.only", "@a=b :prefix  "} {
+		if _, err := ParseIRCMessage(line); err == nil {
+			t.Fatalf(`ParseIRCMessage(%q) = got no error, want error`, line)
+		}
+	}
+}
+
+func TestIRCMessageString(t *testing.T) {
+	m := &IRCMessage{
+		Tags:    map[string]string{"reply-parent-msg-id": "abc-123", "note": "a b;c\\"},
+		Command: "PRIVMSG",
+		Params:  []string{"#channel", "hi there"},
+	}
+	want := "@note=a\\sb\\:c\\\\;reply-parent-msg-id=abc-123 PRIVMSG #channel :hi there"
+	if m.String() != want {
+		t.Fatalf(`String() = got %s, want %s`, m.String(), want)
+	}
+}
+
+func FuzzIRCMessageRoundTrip(f *testing.F) {
+	f.Add("@badge-info=subscriber/3;color=#FF0000;display-name=Foo\\sBar :foo!foo@foo.tmi.twitch.tv PRIVMSG #bar :hello world")
+	f.Add("PING :tmi.twitch.tv")
+	f.Add(":tmi.twitch.tv CLEARCHAT #channel :")
+	f.Add("@msg-id=raid;msg-param-displayName=x=y\\ :tmi.twitch.tv USERNOTICE #channel")
+	f.Add("CMD a :: b")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		m, err := ParseIRCMessage(line)
+		if err != nil {
+			return
+		}
+		encoded := m.String()
+		m2, err := ParseIRCMessage(encoded)
+		if err != nil {
+			t.Fatalf(`ParseIRCMessage(%q) = got error: %s`, encoded, err)
+		}
+		if !reflect.DeepEqual(m, m2) {
+			t.Fatalf(`round trip of %q via %q = got %#v, want %#v`, line, encoded, m2, m)
+		}
+	})
+}
@@ -0,0 +1,265 @@
+package twitchgo
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emoteURLTemplate is the CDN URL for an emote image, by ID and scale
+const emoteURLTemplate = "https://static-cdn.jtvnw.net/emoticons/v2/%s/default/dark/%s"
+
+type Message struct {
+	// ID identifies the message, for deleting it or replying to it
+	ID         string
+	Sender     string
+	Text       string
+	Subscriber bool
+	SubLength  int
+	Mod        bool
+	UserID     string
+	Channel    string
+	RoomID     string
+	// Timestamp is when the Twitch server received the message
+	Timestamp time.Time
+	// Color is the sender's name color as #RRGGBB, empty if they never set one
+	Color string
+	// Bits is the number of bits cheered in the message
+	Bits int
+	// FirstMessage is set on the sender's first ever message in the channel
+	FirstMessage bool
+	// ReturningChatter is set when the sender is chatting again after a
+	// while away
+	ReturningChatter bool
+	// ClientNonce is the value the sending client chose to recognise its own
+	// message
+	ClientNonce string
+	// Reply is set when the message replies to another message
+	Reply *MessageReply
+	// Emotes holds every emote used in Text, in the order they appear
+	Emotes []ChatEmote
+	// Badges maps each badge set the sender shows, such as subscriber or
+	// bits, to the badge version
+	Badges map[string]string
+	// BadgeInfo holds extra detail for some badges, such as the exact number
+	// of months subscribed
+	BadgeInfo map[string]string
+	// Raw is the message as received, with every tag
+	Raw *IRCMessage
+}
+
+// MessageReply describes the message being replied to and the thread it
+// started
+type MessageReply struct {
+	ParentID          string
+	ParentUserID      string
+	ParentUserLogin   string
+	ParentDisplayName string
+	ParentText        string
+	// ThreadParentID and ThreadParentUserLogin identify the first message of
+	// the reply thread
+	ThreadParentID        string
+	ThreadParentUserLogin string
+}
+
+// ChatEmote is an emote used in a chat message. Start and End are rune
+// offsets into the message text, with End exclusive.
+type ChatEmote struct {
+	Emote
+	Start int
+	End   int
+}
+
+// MessageFragment is a piece of a message's text, Emote is set when the
+// fragment is an emote rather than plain text
+type MessageFragment struct {
+	Text  string
+	Emote *Emote
+}
+
+func (c *Chat) parseMessage(msg *IRCMessage) *Message {
+	m := new(Message)
+	m.Channel = msg.Channel()
+	m.Text = msg.Trailing()
+	m.Raw = msg
+
+	// Pull the user, sub, and mod info from the tags
+	m.Sender = msg.Tags["display-name"]
+	if len(m.Sender) == 0 {
+		m.Sender = msg.Nick()
+	}
+	m.Subscriber = msg.Tags["subscriber"] == "1"
+	m.Mod = msg.Tags["mod"] == "1"
+	m.UserID = msg.Tags["user-id"]
+	m.ID = msg.Tags["id"]
+	m.RoomID = msg.Tags["room-id"]
+	m.Timestamp = tagTime(msg, "tmi-sent-ts")
+	m.Color = msg.Tags["color"]
+	m.Bits = tagInt(msg, "bits", 0)
+	m.FirstMessage = msg.Tags["first-msg"] == "1"
+	m.ReturningChatter = msg.Tags["returning-chatter"] == "1"
+	m.ClientNonce = msg.Tags["client-nonce"]
+	if parentID := msg.Tags["reply-parent-msg-id"]; len(parentID) > 0 {
+		m.Reply = &MessageReply{
+			ParentID:              parentID,
+			ParentUserID:          msg.Tags["reply-parent-user-id"],
+			ParentUserLogin:       msg.Tags["reply-parent-user-login"],
+			ParentDisplayName:     msg.Tags["reply-parent-display-name"],
+			ParentText:            msg.Tags["reply-parent-msg-body"],
+			ThreadParentID:        msg.Tags["reply-thread-parent-msg-id"],
+			ThreadParentUserLogin: msg.Tags["reply-thread-parent-user-login"],
+		}
+	}
+	m.Badges = tagBadges(msg, "badges")
+	m.BadgeInfo = tagBadges(msg, "badge-info")
+
+	// Sub length only exists if they are a sub
+	if months, ok := m.BadgeInfo["subscriber"]; ok {
+		subLength, err := strconv.Atoi(months)
+		if err != nil {
+			log.Printf("Could not determine sub length: %s\n", err)
+		} else {
+			m.SubLength = subLength
+		}
+	}
+
+	m.Emotes = parseEmotes(msg.Tags["emotes"], m.Text)
+	return m
+}
+
+// tagTime reads a tag holding milliseconds since the Unix epoch, returning the
+// zero time if it is missing
+func tagTime(msg *IRCMessage, key string) time.Time {
+	ms, err := strconv.ParseInt(msg.Tags[key], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// tagBadges reads a comma separated list of badge/version pairs into a map
+func tagBadges(msg *IRCMessage, key string) map[string]string {
+	badges := map[string]string{}
+	for _, badge := range tagList(msg, key) {
+		name, version, _ := strings.Cut(badge, "/")
+		if len(name) > 0 {
+			badges[name] = version
+		}
+	}
+	return badges
+}
+
+// HasBadge reports whether the sender shows a badge from the given set
+func (m *Message) HasBadge(set string) bool {
+	_, ok := m.Badges[set]
+	return ok
+}
+
+// IsBroadcaster reports whether the sender owns the channel
+func (m *Message) IsBroadcaster() bool {
+	return m.HasBadge("broadcaster")
+}
+
+// IsModerator reports whether the sender is a moderator in the channel
+func (m *Message) IsModerator() bool {
+	return m.Mod || m.HasBadge("moderator")
+}
+
+// IsVIP reports whether the sender is a VIP in the channel
+func (m *Message) IsVIP() bool {
+	return m.HasBadge("vip")
+}
+
+// IsFounder reports whether the sender was one of the channel's first
+// subscribers
+func (m *Message) IsFounder() bool {
+	return m.HasBadge("founder")
+}
+
+// IsPartner reports whether the sender is a verified Twitch partner
+func (m *Message) IsPartner() bool {
+	return m.HasBadge("partner")
+}
+
+// IsStaff reports whether the sender works for Twitch
+func (m *Message) IsStaff() bool {
+	return m.HasBadge("staff")
+}
+
+// parseEmotes reads the emotes tag, which looks like 25:0-4,12-16/1902:6-10.
+// Twitch counts the positions in code points rather than bytes or UTF-16
+// units, so they line up with the runes of the text even after an emoji.
+func parseEmotes(tag string, text string) []ChatEmote {
+	if len(tag) == 0 {
+		return nil
+	}
+	runes := []rune(text)
+
+	var emotes []ChatEmote
+	for _, emote := range strings.Split(tag, "/") {
+		id, ranges, ok := strings.Cut(emote, ":")
+		if !ok || len(id) == 0 {
+			continue
+		}
+		for _, r := range strings.Split(ranges, ",") {
+			first, last, _ := strings.Cut(r, "-")
+			start, err := strconv.Atoi(first)
+			if err != nil {
+				continue
+			}
+			end, err := strconv.Atoi(last)
+			if err != nil || start < 0 || end < start || end >= len(runes) {
+				continue
+			}
+			emotes = append(emotes, ChatEmote{
+				Emote: Emote{
+					ID:     id,
+					Name:   string(runes[start : end+1]),
+					Images: emoteImages(id),
+				},
+				Start: start,
+				End:   end + 1,
+			})
+		}
+	}
+
+	sort.Slice(emotes, func(i, j int) bool {
+		return emotes[i].Start < emotes[j].Start
+	})
+	return emotes
+}
+
+func emoteImages(id string) EmoteImages {
+	return EmoteImages{
+		URL1x: fmt.Sprintf(emoteURLTemplate, id, "1.0"),
+		URL2x: fmt.Sprintf(emoteURLTemplate, id, "2.0"),
+		URL4x: fmt.Sprintf(emoteURLTemplate, id, "3.0"),
+	}
+}
+
+// Fragments splits the text into plain text and emote fragments, in order
+func (m *Message) Fragments() []MessageFragment {
+	runes := []rune(m.Text)
+
+	var fragments []MessageFragment
+	pos := 0
+	for i := range m.Emotes {
+		e := &m.Emotes[i]
+		// Skip anything overlapping the previous emote or past the text
+		if e.Start < pos || e.End > len(runes) {
+			continue
+		}
+		if e.Start > pos {
+			fragments = append(fragments, MessageFragment{Text: string(runes[pos:e.Start])})
+		}
+		fragments = append(fragments, MessageFragment{Text: string(runes[e.Start:e.End]), Emote: &e.Emote})
+		pos = e.End
+	}
+	if pos < len(runes) {
+		fragments = append(fragments, MessageFragment{Text: string(runes[pos:])})
+	}
+	return fragments
+}
@@ -0,0 +1,116 @@
+package twitchgo
+
+import "testing"
+
+func TestParseMessageEmotes(t *testing.T) {
+	// The emoji is one code point but two UTF-16 units and four bytes
+	line := "@emotes=25:7-11,20-24/emotesv2_abc:13-18 :someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :hi 😀 a Kappa FooBar Kappa!"
+	irc, err := ParseIRCMessage(line)
+	if err != nil {
+		t.Fatalf(`ParseIRCMessage(line) = got error: %s`, err)
+	}
+	m := (&Chat{}).parseMessage(irc)
+
+	if len(m.Emotes) != 3 {
+		t.Fatalf(`parseMessage() Emotes = got %d, want 3`, len(m.Emotes))
+	}
+	want := []struct {
+		id, name   string
+		start, end int
+	}{
+		{"25", "Kappa", 7, 12},
+		{"emotesv2_abc", "FooBar", 13, 19},
+		{"25", "Kappa", 20, 25},
+	}
+	for i, w := range want {
+		e := m.Emotes[i]
+		if e.ID != w.id || e.Name != w.name || e.Start != w.start || e.End != w.end {
+			t.Fatalf(`parseMessage() Emotes[%d] = got %s %s %d-%d, want %s %s %d-%d`, i, e.ID, e.Name, e.Start, e.End, w.id, w.name, w.start, w.end)
+		}
+	}
+	if url := m.Emotes[0].Images.URL1x; url != "https://static-cdn.jtvnw.net/emoticons/v2/25/default/dark/1.0" {
+		t.Fatalf(`parseMessage() Images.URL1x = got %s`, url)
+	}
+
+	fragments := m.Fragments()
+	texts := []string{"hi 😀 a ", "Kappa", " ", "FooBar", " ", "Kappa", "!"}
+	if len(fragments) != len(texts) {
+		t.Fatalf(`Fragments() = got %d fragments, want %d`, len(fragments), len(texts))
+	}
+	for i, text := range texts {
+		if fragments[i].Text != text {
+			t.Fatalf(`Fragments()[%d].Text = got %q, want %q`, i, fragments[i].Text, text)
+		} else if isEmote := fragments[i].Emote != nil; isEmote != (i%2 == 1) {
+			t.Fatalf(`Fragments()[%d].Emote = got %t, want %t`, i, isEmote, i%2 == 1)
+		}
+	}
+}
+
+func TestParseMessageBadEmotes(t *testing.T) {
+	// Ranges past the end of the text or malformed are ignored
+	emotes := parseEmotes("25:0-4,3-99/bad/1:x-2", "Kappa")
+	if len(emotes) != 1 || emotes[0].Name != "Kappa" {
+		t.Fatalf(`parseEmotes() = got %v, want only Kappa`, emotes)
+	}
+
+	m := &Message{Text: "no emotes"}
+	if fragments := m.Fragments(); len(fragments) != 1 || fragments[0].Text != "no emotes" {
+		t.Fatalf(`Fragments() = got %v, want the whole text`, fragments)
+	}
+}
+
+func TestParseMessageBadges(t *testing.T) {
+	line := "@badge-info=subscriber/14,predictions/blue-1;badges=vip/1,founder/0,bits/1000,premium/1;mod=0 :someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :hello"
+	irc, err := ParseIRCMessage(line)
+	if err != nil {
+		t.Fatalf(`ParseIRCMessage(line) = got error: %s`, err)
+	}
+	m := (&Chat{}).parseMessage(irc)
+
+	if len(m.Badges) != 4 || m.Badges["bits"] != "1000" {
+		t.Fatalf(`parseMessage() Badges = got %v, want 4 badges with bits/1000`, m.Badges)
+	} else if m.BadgeInfo["predictions"] != "blue-1" {
+		t.Fatalf(`parseMessage() BadgeInfo = got %v, want predictions/blue-1`, m.BadgeInfo)
+	} else if m.SubLength != 14 {
+		t.Fatalf(`parseMessage() SubLength = got %d, want 14`, m.SubLength)
+	} else if !m.IsVIP() || !m.IsFounder() {
+		t.Fatalf(`IsVIP()/IsFounder() = got %t/%t, want true/true`, m.IsVIP(), m.IsFounder())
+	} else if m.IsBroadcaster() || m.IsModerator() || m.IsStaff() || m.IsPartner() {
+		t.Fatalf(`IsBroadcaster()/IsModerator()/IsStaff()/IsPartner() = got true, want false`)
+	}
+}
+
+func TestParseMessageMetadata(t *testing.T) {
+	line := `@bits=100;client-nonce=abc123;color=#1E90FF;first-msg=1;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;reply-parent-display-name=Other\sUser;reply-parent-msg-body=hi\sthere;reply-parent-msg-id=p1;reply-parent-user-id=42;reply-parent-user-login=otheruser;reply-thread-parent-msg-id=t1;reply-thread-parent-user-login=threaduser;returning-chatter=0;room-id=1337;tmi-sent-ts=1642696567751 :someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :@otheruser cheer100 hello`
+	irc, err := ParseIRCMessage(line)
+	if err != nil {
+		t.Fatalf(`ParseIRCMessage(line) = got error: %s`, err)
+	}
+	m := (&Chat{}).parseMessage(irc)
+
+	if m.ID != "b34ccfc7-4977-403a-8a94-33c6bac34fb8" {
+		t.Fatalf(`parseMessage() ID = got %s`, m.ID)
+	} else if m.Timestamp.UnixMilli() != 1642696567751 {
+		t.Fatalf(`parseMessage() Timestamp = got %s, want 1642696567751ms`, m.Timestamp)
+	} else if m.Color != "#1E90FF" || m.RoomID != "1337" || m.ClientNonce != "abc123" {
+		t.Fatalf(`parseMessage() Color/RoomID/ClientNonce = got %s/%s/%s`, m.Color, m.RoomID, m.ClientNonce)
+	} else if m.Bits != 100 {
+		t.Fatalf(`parseMessage() Bits = got %d, want 100`, m.Bits)
+	} else if !m.FirstMessage || m.ReturningChatter {
+		t.Fatalf(`parseMessage() FirstMessage/ReturningChatter = got %t/%t, want true/false`, m.FirstMessage, m.ReturningChatter)
+	} else if m.Raw.Tags["id"] != m.ID {
+		t.Fatalf(`parseMessage() Raw = got tags %v`, m.Raw.Tags)
+	}
+
+	want := MessageReply{"p1", "42", "otheruser", "Other User", "hi there", "t1", "threaduser"}
+	if m.Reply == nil || *m.Reply != want {
+		t.Fatalf(`parseMessage() Reply = got %v, want %v`, m.Reply, want)
+	}
+
+	// Without the tags everything is left empty
+	irc, _ = ParseIRCMessage(":someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :hello")
+	m = (&Chat{}).parseMessage(irc)
+	if m.Reply != nil || !m.Timestamp.IsZero() || m.Bits != 0 {
+		t.Fatalf(`parseMessage() = got Reply %v, Timestamp %s, Bits %d, want empty`, m.Reply, m.Timestamp, m.Bits)
+	}
+}
@@ -0,0 +1,82 @@
+package twitchgo
+
+import "net/http"
+
+// Option configures a Twitch client when passed to NewTwitch
+type Option func(*Twitch)
+
+// Middleware wraps the round tripper that sends every Helix and OAuth
+// request, to log, measure or change them
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc turns a function into an http.RoundTripper, which is
+// handy for writing Middleware
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithHTTPClient sends requests with the given client instead of a default
+// one. The client itself isn't modified.
+func WithHTTPClient(client *http.Client) Option {
+	return func(t *Twitch) {
+		t.baseClient = client
+	}
+}
+
+// WithTransport sends requests through the given round tripper, replacing
+// the transport of the HTTP client
+func WithTransport(transport http.RoundTripper) Option {
+	return func(t *Twitch) {
+		t.transport = transport
+	}
+}
+
+// WithMiddleware wraps every request in the given middleware. The first
+// middleware sees each request first and its response last.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(t *Twitch) {
+		t.middleware = append(t.middleware, middleware...)
+	}
+}
+
+// WithScopes requests the scopes on top of the ones the client always needs
+func WithScopes(scopes ...Scope) Option {
+	return func(t *Twitch) {
+		t.scopes = append(t.scopes, scopes...)
+	}
+}
+
+// WithForceVerify shows the Twitch consent screen on every login, even if the
+// user already authorized the client
+func WithForceVerify() Option {
+	return func(t *Twitch) {
+		t.forceVerify = true
+	}
+}
+
+// buildClient puts together the HTTP client from the options
+func (t *Twitch) buildClient() *http.Client {
+	client := &http.Client{}
+	if t.baseClient != nil {
+		// Copy the client so adding middleware doesn't change the original
+		c := *t.baseClient
+		client = &c
+	}
+	if t.transport != nil {
+		client.Transport = t.transport
+	}
+
+	if len(t.middleware) > 0 {
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		for i := len(t.middleware) - 1; i >= 0; i-- {
+			transport = t.middleware[i](transport)
+		}
+		client.Transport = transport
+	}
+	return client
+}
@@ -0,0 +1,55 @@
+package twitchgo_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/brianmmcclain/twitchgo"
+)
+
+func TestOptions(t *testing.T) {
+	const TEST_NAME = "Options"
+
+	// A fake transport stands in for Twitch
+	var got *http.Request
+	transport := twitchgo.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		got = r
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(testUserJSON)),
+			Request:    r,
+		}, nil
+	})
+
+	// Middleware run in the order given
+	var order []string
+	middleware := func(name string) twitchgo.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return twitchgo.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				r.Header.Set("X-"+name, "1")
+				return next.RoundTrip(r)
+			})
+		}
+	}
+
+	client := &http.Client{}
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c,
+		twitchgo.WithHTTPClient(client),
+		twitchgo.WithTransport(transport),
+		twitchgo.WithMiddleware(middleware("First"), middleware("Second")),
+	)
+	u, err := twitchConn.GetUserByLogin("testUser")
+
+	verify(err, nil, TEST_NAME, "Err", t)
+	verify(u.ID, "141981764", TEST_NAME, "UserID", t)
+	verify(len(order), 2, TEST_NAME, "MiddlewareCount", t)
+	verify(order[0], "First", TEST_NAME, "MiddlewareOrder", t)
+	verify(got.Header.Get("X-Second"), "1", TEST_NAME, "MiddlewareHeader", t)
+	verify(got.Header.Get("Client-Id"), "MyID", TEST_NAME, "ClientID", t)
+	verify(client.Transport, nil, TEST_NAME, "ClientUnchanged", t)
+}
@@ -0,0 +1,113 @@
+package twitchgo
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// maxPageSize is the most items Helix returns in one page
+const maxPageSize = 100
+
+type Pagination struct {
+	Cursor string `json:"cursor"`
+}
+
+type pageResponse[T any] struct {
+	Data       []T        `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// Paginator walks the pages of a Helix list endpoint, following the cursor
+// Twitch returns with each page:
+//
+//	streams := twitch.PaginateFollowedStreams(user, 100)
+//	for streams.Next() {
+//		for _, s := range streams.Page() {
+//			...
+//		}
+//	}
+//	if err := streams.Err(); err != nil {
+//		...
+//	}
+type Paginator[T any] struct {
+	ctx     context.Context
+	twitch  *Twitch
+	request *Request
+	first   int
+	cursor  string
+	started bool
+	page    []T
+	err     error
+}
+
+// newPaginator pages through the request's results under ctx, asking for
+// first items per page. If first is 0 Twitch's default page size is used.
+func newPaginator[T any](ctx context.Context, t *Twitch, request *Request, first int) *Paginator[T] {
+	if first > maxPageSize {
+		first = maxPageSize
+	}
+	return &Paginator[T]{ctx: ctx, twitch: t, request: request, first: first}
+}
+
+// Next fetches the next page, returning false once there are no more pages or
+// a request fails
+func (p *Paginator[T]) Next() bool {
+	if p.err != nil || (p.started && len(p.cursor) == 0) {
+		return false
+	}
+
+	// Each page is the same request with a different cursor
+	req := *p.request
+	req.Query = url.Values{}
+	for key, values := range p.request.Query {
+		req.Query[key] = values
+	}
+	if p.first > 0 {
+		req.Query.Set("first", strconv.Itoa(p.first))
+	}
+	if len(p.cursor) > 0 {
+		req.Query.Set("after", p.cursor)
+	}
+
+	resp := new(pageResponse[T])
+	if err := p.twitch.Do(p.ctx, &req, resp); err != nil {
+		p.err = err
+		return false
+	}
+
+	p.started = true
+	p.page = resp.Data
+	p.cursor = resp.Pagination.Cursor
+	// An empty page means we've run out, whatever the cursor says
+	if len(p.page) == 0 {
+		p.cursor = ""
+		return false
+	}
+	return true
+}
+
+// Page returns the items of the page fetched by the last call to Next
+func (p *Paginator[T]) Page() []T {
+	return p.page
+}
+
+// Cursor returns the cursor for the page after the current one, empty when
+// this is the last page
+func (p *Paginator[T]) Cursor() string {
+	return p.cursor
+}
+
+// Err returns the error that stopped Next, if any
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+// All fetches every remaining page and returns their items together
+func (p *Paginator[T]) All() ([]T, error) {
+	var all []T
+	for p.Next() {
+		all = append(all, p.page...)
+	}
+	return all, p.err
+}
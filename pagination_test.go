@@ -0,0 +1,53 @@
+package twitchgo_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brianmmcclain/twitchgo"
+)
+
+func TestPaginateFollowedStreams(t *testing.T) {
+	const TEST_NAME = "PaginateFollowedStreams"
+
+	// Set up the test server, serving three pages of two streams
+	var firsts []string
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			firsts = append(firsts, r.URL.Query().Get("first"))
+			page, next := 0, `"cursor": "page1"`
+			switch r.URL.Query().Get("after") {
+			case "page1":
+				page, next = 1, `"cursor": "page2"`
+			case "page2":
+				page, next = 2, ``
+			}
+			fmt.Fprintf(w, `{"data": [{"id": "%d"}, {"id": "%d"}], "pagination": {%s}}`, page*2, page*2+1, next)
+		}))
+	defer svr.Close()
+
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c)
+	twitchConn.BaseApiUrl = svr.URL
+
+	// Walk the pages one at a time
+	pages := twitchConn.PaginateFollowedStreams(testUser, 2)
+	count := 0
+	for pages.Next() {
+		verify(pages.Page()[0].ID, fmt.Sprint(count*2), TEST_NAME, "FirstStreamID", t)
+		count++
+	}
+	verify(pages.Err(), nil, TEST_NAME, "Err", t)
+	verify(count, 3, TEST_NAME, "PageCount", t)
+	verify(firsts[0], "2", TEST_NAME, "First", t)
+	verify(pages.Next(), false, TEST_NAME, "NextAfterLastPage", t)
+
+	// All streams come back together
+	streams, err := twitchConn.GetFollowedStreams(testUser)
+	verify(err, nil, TEST_NAME, "GetFollowedStreamsErr", t)
+	verify(len(streams), 6, TEST_NAME, "StreamCount", t)
+	verify(streams[5].ID, "5", TEST_NAME, "LastStreamID", t)
+	verify(firsts[len(firsts)-1], "100", TEST_NAME, "DefaultFirst", t)
+}
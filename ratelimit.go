@@ -0,0 +1,105 @@
+package twitchgo
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimitRetries is how many times a request that was answered with 429
+// Too Many Requests is retried once the bucket resets
+const maxRateLimitRetries = 3
+
+// RateLimit is the state of a Helix rate limit bucket, read from the
+// Ratelimit headers of a response
+type RateLimit struct {
+	// Limit is how many points the bucket holds when full
+	Limit int
+	// Remaining is how many points are left in the bucket
+	Remaining int
+	// Reset is when the bucket is next refilled
+	Reset time.Time
+}
+
+// parseRateLimit reads the Ratelimit headers, leaving any that are missing as
+// zero
+func parseRateLimit(header http.Header) RateLimit {
+	var r RateLimit
+	r.Limit, _ = strconv.Atoi(header.Get("Ratelimit-Limit"))
+	r.Remaining, _ = strconv.Atoi(header.Get("Ratelimit-Remaining"))
+	if reset, err := strconv.ParseInt(header.Get("Ratelimit-Reset"), 10, 64); err == nil {
+		r.Reset = time.Unix(reset, 0)
+	}
+	return r
+}
+
+// helixRateLimiter tracks the Helix bucket from the headers of each response
+// and holds requests back while it is empty. Until the first response it
+// lets everything through.
+type helixRateLimiter struct {
+	mu    sync.Mutex
+	state RateLimit
+	known bool
+}
+
+// wait blocks until the bucket has a point for another request, then takes it
+func (l *helixRateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if !l.known || l.state.Remaining > 0 {
+			l.state.Remaining--
+			l.mu.Unlock()
+			return nil
+		} else if !now.Before(l.state.Reset) {
+			// The bucket has been refilled since we last heard
+			l.state.Remaining = l.state.Limit - 1
+			l.mu.Unlock()
+			return nil
+		}
+		delay := l.state.Reset.Sub(now)
+		l.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// update records the bucket state reported by a response
+func (l *helixRateLimiter) update(status int, header http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	r := parseRateLimit(header)
+	if len(header.Get("Ratelimit-Remaining")) > 0 {
+		l.state = r
+		l.known = true
+	}
+	if status == http.StatusTooManyRequests {
+		// Make sure we back off even if the headers were missing
+		l.known = true
+		l.state.Remaining = 0
+		if l.state.Reset.IsZero() {
+			l.state.Reset = time.Now().Add(time.Second)
+		}
+	}
+}
+
+func (l *helixRateLimiter) current() RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// RateLimit returns the state of the Helix rate limit bucket as of the last
+// response. Remaining also counts down for requests still in flight.
+func (t *Twitch) RateLimit() RateLimit {
+	return t.rateLimit.current()
+}
@@ -0,0 +1,71 @@
+package twitchgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHelixRateLimiterWait(t *testing.T) {
+	var l helixRateLimiter
+
+	// Nothing is held back before the first response
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatalf(`wait() = got error %s, want nil`, err)
+	}
+
+	// An empty bucket blocks until it resets
+	l.state = RateLimit{Limit: 800, Remaining: 0, Reset: time.Now().Add(50 * time.Millisecond)}
+	l.known = true
+	start := time.Now()
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatalf(`wait() = got error %s, want nil`, err)
+	} else if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Fatalf(`wait() = returned after %s, want at least 40ms`, waited)
+	} else if remaining := l.current().Remaining; remaining != 799 {
+		t.Fatalf(`wait() Remaining = got %d, want 799`, remaining)
+	}
+
+	// Waiting gives up when the context is done
+	l.state = RateLimit{Limit: 800, Remaining: 0, Reset: time.Now().Add(time.Hour)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf(`wait() = got error %v, want context.DeadlineExceeded`, err)
+	}
+}
+
+func TestDoRequestRetriesRateLimited(t *testing.T) {
+	// Set up the test server, refusing the first request
+	requests := 0
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Ratelimit-Limit", "800")
+			// The reset time is already past so the test doesn't wait
+			w.Header().Set("Ratelimit-Reset", strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+			if requests == 1 {
+				w.Header().Set("Ratelimit-Remaining", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Header().Set("Ratelimit-Remaining", "797")
+			fmt.Fprint(w, `{"data": []}`)
+		}))
+	defer svr.Close()
+
+	twitch := NewTwitch(&Configuration{Token: Token{AccessToken: "token"}})
+	twitch.BaseApiUrl = svr.URL
+	if _, err := doRequest(context.Background(), NewRequest("GET", "/users"), twitch); err != nil {
+		t.Fatalf(`doRequest() = got error %s, want nil`, err)
+	} else if requests != 2 {
+		t.Fatalf(`doRequest() requests = got %d, want 2`, requests)
+	} else if rl := twitch.RateLimit(); rl.Limit != 800 || rl.Remaining != 797 {
+		t.Fatalf(`RateLimit() = got %d/%d, want 797/800`, rl.Remaining, rl.Limit)
+	}
+}
@@ -0,0 +1,92 @@
+package twitchgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Request describes a Helix API call, for endpoints this package doesn't
+// wrap yet:
+//
+//	req := twitchgo.NewRequest("POST", "/moderation/bans").
+//		Param("broadcaster_id", broadcaster.ID).
+//		Param("moderator_id", moderator.ID).
+//		JSON(ban)
+//	err := twitch.Do(ctx, req, nil)
+type Request struct {
+	Method string
+	// Path is the endpoint path under the Helix base URL, such as /users
+	Path  string
+	Query url.Values
+	// Body is encoded as JSON and sent as the request body, if set
+	Body interface{}
+	// TokenType picks the user or app access token for the request
+	TokenType TokenType
+}
+
+// NewRequest starts a request for the method and path
+func NewRequest(method string, path string) *Request {
+	return &Request{Method: method, Path: path, Query: url.Values{}}
+}
+
+// Param adds a query parameter, which may be repeated to pass several values
+func (r *Request) Param(key string, value string) *Request {
+	if r.Query == nil {
+		r.Query = url.Values{}
+	}
+	r.Query.Add(key, value)
+	return r
+}
+
+// JSON sets the value sent as the request body
+func (r *Request) JSON(body interface{}) *Request {
+	r.Body = body
+	return r
+}
+
+// UseToken sets which access token the request is sent with
+func (r *Request) UseToken(tokenType TokenType) *Request {
+	r.TokenType = tokenType
+	return r
+}
+
+// url builds the full request URL under base
+func (r *Request) url(base string) string {
+	requestURL := base + r.Path
+	if len(r.Query) > 0 {
+		requestURL += "?" + r.Query.Encode()
+	}
+	return requestURL
+}
+
+// body encodes the request body, returning nil if there isn't one
+func (r *Request) body() ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := json.Marshal(r.Body)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Error encoding request body: %v", err))
+	}
+	return body, nil
+}
+
+// Do sends the request, decoding the JSON response into out unless out is nil
+// or the response is empty
+func (t *Twitch) Do(ctx context.Context, r *Request, out interface{}) error {
+	respBody, err := doRequest(ctx, r, t)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(bytes.TrimSpace(respBody)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return errors.New(fmt.Sprintf("Error parsing response: %v", err))
+	}
+	return nil
+}
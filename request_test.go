@@ -0,0 +1,74 @@
+package twitchgo_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brianmmcclain/twitchgo"
+)
+
+func TestDo(t *testing.T) {
+	const TEST_NAME = "Do"
+
+	// Set up the test server, echoing back what it was sent
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "DELETE" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			fmt.Fprintf(w, `{"method": %q, "uri": %q, "content_type": %q, "reason": %q}`,
+				r.Method, r.URL.RequestURI(), r.Header.Get("Content-Type"), body["reason"])
+		}))
+	defer svr.Close()
+
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c)
+	twitchConn.BaseApiUrl = svr.URL
+
+	var got struct {
+		Method      string `json:"method"`
+		URI         string `json:"uri"`
+		ContentType string `json:"content_type"`
+		Reason      string `json:"reason"`
+	}
+	req := twitchgo.NewRequest("POST", "/moderation/bans").
+		Param("broadcaster_id", "1").
+		Param("moderator_id", "a&b=c").
+		JSON(map[string]string{"reason": "spam"})
+	err := twitchConn.Do(context.Background(), req, &got)
+
+	verify(err, nil, TEST_NAME, "Err", t)
+	verify(got.Method, "POST", TEST_NAME, "Method", t)
+	verify(got.URI, "/moderation/bans?broadcaster_id=1&moderator_id=a%26b%3Dc", TEST_NAME, "URI", t)
+	verify(got.ContentType, "application/json", TEST_NAME, "ContentType", t)
+	verify(got.Reason, "spam", TEST_NAME, "Reason", t)
+
+	// An empty response leaves out alone
+	err = twitchConn.Do(context.Background(), twitchgo.NewRequest("DELETE", "/moderation/bans"), &got)
+	verify(err, nil, TEST_NAME, "NoContentErr", t)
+	verify(got.Method, "POST", TEST_NAME, "NoContentOut", t)
+}
+
+func TestGetUserByLoginEscapesQuery(t *testing.T) {
+	var query string
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			fmt.Fprint(w, testUserJSON)
+		}))
+	defer svr.Close()
+
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c)
+	twitchConn.BaseApiUrl = svr.URL
+	twitchConn.GetUserByLogin("a&id=1")
+
+	verify(query, "login=a%26id%3D1", "GetUserByLogin", "Query", t)
+}
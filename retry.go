@@ -0,0 +1,101 @@
+package twitchgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides which failed Helix requests are tried again. Any field
+// left as its zero value uses the default.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a request is tried in total. Defaults to
+	// 3, set it to 1 to turn retries off.
+	MaxAttempts int
+	// Backoff spaces out the attempts. Defaults to starting at 1 second.
+	Backoff Backoff
+	// RetryableStatus reports whether a response status is worth retrying.
+	// Defaults to 500, 502, 503 and 504.
+	RetryableStatus func(status int) bool
+	// RetryableError reports whether an error sending the request or reading
+	// the response is worth retrying. Defaults to timeouts, refused or reset
+	// connections and responses cut short.
+	RetryableError func(err error) bool
+	// RetryNonIdempotent allows POST and PATCH requests to be retried, which
+	// repeats their effect if a failed attempt did reach Twitch
+	RetryNonIdempotent bool
+}
+
+// canRetry reports whether another attempt of the request is allowed,
+// attempt counting from 0
+func (p RetryPolicy) canRetry(method string, attempt int) bool {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	if attempt+1 >= maxAttempts {
+		return false
+	}
+	return p.RetryNonIdempotent || isIdempotent(method)
+}
+
+func (p RetryPolicy) retryStatus(method string, attempt int, status int) bool {
+	if !p.canRetry(method, attempt) {
+		return false
+	} else if p.RetryableStatus != nil {
+		return p.RetryableStatus(status)
+	}
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (p RetryPolicy) retryError(method string, attempt int, err error) bool {
+	if !p.canRetry(method, attempt) {
+		return false
+	} else if p.RetryableError != nil {
+		return p.RetryableError(err)
+	}
+	return isTransientError(err)
+}
+
+// wait sleeps before the next attempt, returning early with the context's
+// error if it is done
+func (p RetryPolicy) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(p.Backoff.Delay(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// isTransientError reports whether the error is likely to go away if the
+// request is tried again
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	} else if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	} else if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
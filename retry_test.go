@@ -0,0 +1,69 @@
+package twitchgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoRequestRetries(t *testing.T) {
+	// Set up the test server, failing the first two requests
+	requests := 0
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			switch requests {
+			case 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case 2:
+				// Drop the connection without answering
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+			default:
+				fmt.Fprint(w, `{"data": []}`)
+			}
+		}))
+	defer svr.Close()
+
+	twitch := NewTwitch(&Configuration{Token: Token{AccessToken: "token"}})
+	twitch.BaseApiUrl = svr.URL
+	twitch.Retry = RetryPolicy{Backoff: Backoff{Min: time.Millisecond}}
+	if _, err := doRequest(context.Background(), NewRequest("GET", "/users"), twitch); err != nil {
+		t.Fatalf(`doRequest() = got error %s, want nil`, err)
+	} else if requests != 3 {
+		t.Fatalf(`doRequest() requests = got %d, want 3`, requests)
+	}
+
+	// Once out of attempts the last error is returned
+	requests = 0
+	twitch.Retry.MaxAttempts = 1
+	var apiErr *APIError
+	if _, err := doRequest(context.Background(), NewRequest("GET", "/users"), twitch); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf(`doRequest() = got error %v, want 503 APIError`, err)
+	} else if requests != 1 {
+		t.Fatalf(`doRequest() requests = got %d, want 1`, requests)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var p RetryPolicy
+	if !p.retryStatus("GET", 0, http.StatusBadGateway) {
+		t.Fatalf(`retryStatus(GET, 502) = got false, want true`)
+	} else if p.retryStatus("GET", 0, http.StatusNotFound) {
+		t.Fatalf(`retryStatus(GET, 404) = got true, want false`)
+	} else if p.retryStatus("GET", 2, http.StatusBadGateway) {
+		t.Fatalf(`retryStatus() on the last attempt = got true, want false`)
+	} else if p.retryStatus("POST", 0, http.StatusBadGateway) {
+		t.Fatalf(`retryStatus(POST, 502) = got true, want false`)
+	}
+
+	p.RetryNonIdempotent = true
+	p.RetryableStatus = func(status int) bool { return status == http.StatusNotFound }
+	if !p.retryStatus("POST", 0, http.StatusNotFound) {
+		t.Fatalf(`retryStatus(POST, 404) with custom policy = got false, want true`)
+	}
+}
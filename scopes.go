@@ -0,0 +1,148 @@
+package twitchgo
+
+import "strings"
+
+// Scope is an OAuth scope a user grants to the client
+type Scope string
+
+// Helix API scopes
+const (
+	ScopeAnalyticsReadExtensions        Scope = "analytics:read:extensions"
+	ScopeAnalyticsReadGames             Scope = "analytics:read:games"
+	ScopeBitsRead                       Scope = "bits:read"
+	ScopeChannelBot                     Scope = "channel:bot"
+	ScopeChannelEditCommercial          Scope = "channel:edit:commercial"
+	ScopeChannelManageAds               Scope = "channel:manage:ads"
+	ScopeChannelManageBroadcast         Scope = "channel:manage:broadcast"
+	ScopeChannelManageExtensions        Scope = "channel:manage:extensions"
+	ScopeChannelManageGuestStar         Scope = "channel:manage:guest_star"
+	ScopeChannelManageModerators        Scope = "channel:manage:moderators"
+	ScopeChannelManagePolls             Scope = "channel:manage:polls"
+	ScopeChannelManagePredictions       Scope = "channel:manage:predictions"
+	ScopeChannelManageRaids             Scope = "channel:manage:raids"
+	ScopeChannelManageRedemptions       Scope = "channel:manage:redemptions"
+	ScopeChannelManageSchedule          Scope = "channel:manage:schedule"
+	ScopeChannelManageVideos            Scope = "channel:manage:videos"
+	ScopeChannelManageVIPs              Scope = "channel:manage:vips"
+	ScopeChannelModerate                Scope = "channel:moderate"
+	ScopeChannelReadAds                 Scope = "channel:read:ads"
+	ScopeChannelReadCharity             Scope = "channel:read:charity"
+	ScopeChannelReadEditors             Scope = "channel:read:editors"
+	ScopeChannelReadGoals               Scope = "channel:read:goals"
+	ScopeChannelReadGuestStar           Scope = "channel:read:guest_star"
+	ScopeChannelReadHypeTrain           Scope = "channel:read:hype_train"
+	ScopeChannelReadPolls               Scope = "channel:read:polls"
+	ScopeChannelReadPredictions         Scope = "channel:read:predictions"
+	ScopeChannelReadRedemptions         Scope = "channel:read:redemptions"
+	ScopeChannelReadStreamKey           Scope = "channel:read:stream_key"
+	ScopeChannelReadSubscriptions       Scope = "channel:read:subscriptions"
+	ScopeChannelReadVIPs                Scope = "channel:read:vips"
+	ScopeClipsEdit                      Scope = "clips:edit"
+	ScopeModerationRead                 Scope = "moderation:read"
+	ScopeModeratorManageAnnouncements   Scope = "moderator:manage:announcements"
+	ScopeModeratorManageAutomod         Scope = "moderator:manage:automod"
+	ScopeModeratorManageAutomodSettings Scope = "moderator:manage:automod_settings"
+	ScopeModeratorManageBannedUsers     Scope = "moderator:manage:banned_users"
+	ScopeModeratorManageBlockedTerms    Scope = "moderator:manage:blocked_terms"
+	ScopeModeratorManageChatMessages    Scope = "moderator:manage:chat_messages"
+	ScopeModeratorManageChatSettings    Scope = "moderator:manage:chat_settings"
+	ScopeModeratorManageGuestStar       Scope = "moderator:manage:guest_star"
+	ScopeModeratorManageShieldMode      Scope = "moderator:manage:shield_mode"
+	ScopeModeratorManageShoutouts       Scope = "moderator:manage:shoutouts"
+	ScopeModeratorManageUnbanRequests   Scope = "moderator:manage:unban_requests"
+	ScopeModeratorManageWarnings        Scope = "moderator:manage:warnings"
+	ScopeModeratorReadAutomodSettings   Scope = "moderator:read:automod_settings"
+	ScopeModeratorReadBannedUsers       Scope = "moderator:read:banned_users"
+	ScopeModeratorReadBlockedTerms      Scope = "moderator:read:blocked_terms"
+	ScopeModeratorReadChatMessages      Scope = "moderator:read:chat_messages"
+	ScopeModeratorReadChatSettings      Scope = "moderator:read:chat_settings"
+	ScopeModeratorReadChatters          Scope = "moderator:read:chatters"
+	ScopeModeratorReadFollowers         Scope = "moderator:read:followers"
+	ScopeModeratorReadGuestStar         Scope = "moderator:read:guest_star"
+	ScopeModeratorReadModerators        Scope = "moderator:read:moderators"
+	ScopeModeratorReadShieldMode        Scope = "moderator:read:shield_mode"
+	ScopeModeratorReadShoutouts         Scope = "moderator:read:shoutouts"
+	ScopeModeratorReadSuspiciousUsers   Scope = "moderator:read:suspicious_users"
+	ScopeModeratorReadUnbanRequests     Scope = "moderator:read:unban_requests"
+	ScopeModeratorReadVIPs              Scope = "moderator:read:vips"
+	ScopeModeratorReadWarnings          Scope = "moderator:read:warnings"
+	ScopeUserBot                        Scope = "user:bot"
+	ScopeUserEdit                       Scope = "user:edit"
+	ScopeUserEditBroadcast              Scope = "user:edit:broadcast"
+	ScopeUserManageBlockedUsers         Scope = "user:manage:blocked_users"
+	ScopeUserManageChatColor            Scope = "user:manage:chat_color"
+	ScopeUserManageWhispers             Scope = "user:manage:whispers"
+	ScopeUserReadBlockedUsers           Scope = "user:read:blocked_users"
+	ScopeUserReadBroadcast              Scope = "user:read:broadcast"
+	ScopeUserReadChat                   Scope = "user:read:chat"
+	ScopeUserReadEmail                  Scope = "user:read:email"
+	ScopeUserReadEmotes                 Scope = "user:read:emotes"
+	ScopeUserReadFollows                Scope = "user:read:follows"
+	ScopeUserReadModeratedChannels      Scope = "user:read:moderated_channels"
+	ScopeUserReadSubscriptions          Scope = "user:read:subscriptions"
+	ScopeUserReadWhispers               Scope = "user:read:whispers"
+	ScopeUserWriteChat                  Scope = "user:write:chat"
+)
+
+// IRC chat scopes
+const (
+	ScopeChatRead Scope = "chat:read"
+	ScopeChatEdit Scope = "chat:edit"
+)
+
+// defaultScopes are always requested, as the client uses them for followed
+// streams and chat
+var defaultScopes = []Scope{ScopeUserReadFollows, ScopeChatRead, ScopeChatEdit}
+
+// legacyScopes are the scopes older versions of the client asked for, before
+// the token's scopes were saved
+var legacyScopes = []Scope{ScopeUserReadFollows, ScopeChatRead}
+
+// requiredScopes returns the default scopes followed by any the config or
+// options asked for, without repeats
+func (t *Twitch) requiredScopes() []Scope {
+	var scopes []Scope
+	seen := map[Scope]bool{}
+	for _, list := range [][]Scope{defaultScopes, t.config.Scopes, t.scopes} {
+		for _, scope := range list {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// scopeParam joins the required scopes for an OAuth request
+func (t *Twitch) scopeParam() string {
+	scopes := t.requiredScopes()
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, " ")
+}
+
+// missingScopes returns the required scopes the token wasn't granted. Tokens
+// saved before scopes were recorded only have the scopes older versions asked
+// for.
+func (t *Twitch) missingScopes(token Token) []Scope {
+	granted := map[Scope]bool{}
+	if token.Scope == nil {
+		for _, scope := range legacyScopes {
+			granted[scope] = true
+		}
+	}
+	for _, scope := range token.Scope {
+		granted[Scope(scope)] = true
+	}
+
+	var missing []Scope
+	for _, scope := range t.requiredScopes() {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,47 @@
+package twitchgo
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestScopes(t *testing.T) {
+	config := &Configuration{ClientID: "MyID", Scopes: []Scope{ScopeModeratorManageBannedUsers, ScopeChatRead}}
+	twitch := NewTwitch(config, WithScopes(ScopeClipsEdit), WithForceVerify())
+
+	// The login asks for the default scopes plus the configured ones
+	authURL, _ := url.Parse(twitch.authorizeURL())
+	want := "user:read:follows chat:read chat:edit moderator:manage:banned_users clips:edit"
+	if got := authURL.Query().Get("scope"); got != want {
+		t.Fatalf(`authorizeURL() scope = got %s, want %s`, got, want)
+	} else if authURL.Query().Get("force_verify") != "true" {
+		t.Fatalf(`authorizeURL() force_verify = got %s, want true`, authURL.Query().Get("force_verify"))
+	}
+
+	// A token saved without its scopes only has the ones older versions
+	// asked for, so it lacks chat:edit
+	missing := twitch.missingScopes(Token{})
+	if len(missing) != 3 || missing[0] != ScopeChatEdit || missing[1] != ScopeModeratorManageBannedUsers || missing[2] != ScopeClipsEdit {
+		t.Fatalf(`missingScopes() = got %v, want chat:edit and the configured scopes`, missing)
+	}
+	if missing := NewTwitch(&Configuration{}).missingScopes(Token{}); len(missing) != 1 || missing[0] != ScopeChatEdit {
+		t.Fatalf(`missingScopes() = got %v, want [chat:edit]`, missing)
+	}
+	granted := Token{Scope: []string{"chat:read", "chat:edit", "user:read:follows", "moderator:manage:banned_users", "clips:edit"}}
+	if missing := twitch.missingScopes(granted); len(missing) != 0 {
+		t.Fatalf(`missingScopes() = got %v, want none`, missing)
+	}
+
+	// A valid token missing a scope can't be reused, so the user consents
+	// again
+	config.Token = Token{AccessToken: "access", RefreshToken: "refresh", Expires: time.Now().Add(time.Hour)}
+	if ok, err := twitch.reuseToken(context.Background()); ok || err != nil {
+		t.Fatalf(`reuseToken() = got %t/%v, want false/nil`, ok, err)
+	}
+	config.Token.Scope = granted.Scope
+	if ok, err := twitch.reuseToken(context.Background()); !ok || err != nil {
+		t.Fatalf(`reuseToken() = got %t/%v, want true/nil`, ok, err)
+	}
+}
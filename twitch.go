@@ -1,65 +1,193 @@
 package twitchgo
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"sync"
+	"time"
 )
 
+// defaultRequestTimeout limits each attempt of a Helix request when
+// Twitch.Timeout isn't set
+const defaultRequestTimeout = 30 * time.Second
+
 type Twitch struct {
 	config     *Configuration
 	server     http.Server
 	user       User
+	userMu     sync.Mutex
+	tokenMu    sync.Mutex
+	refreshMu  sync.Mutex
 	waitGroup  *sync.WaitGroup
+	rateLimit  helixRateLimiter
 	BaseApiUrl string
+	// BaseAuthUrl is where OAuth tokens are requested from
+	BaseAuthUrl string
+	client      *http.Client
+	baseClient  *http.Client
+	transport   http.RoundTripper
+	middleware  []Middleware
+	scopes      []Scope
+	forceVerify bool
+	// Retry decides which failed Helix requests are tried again
+	Retry RetryPolicy
+	// Timeout limits each attempt of a Helix request, and each OAuth request.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
 }
 
-func NewTwitch(config *Configuration) *Twitch {
+func NewTwitch(config *Configuration, options ...Option) *Twitch {
 	t := new(Twitch)
 	t.config = config
 	t.BaseApiUrl = "https://api.twitch.tv/helix"
+	t.BaseAuthUrl = "https://id.twitch.tv/oauth2"
+	for _, option := range options {
+		option(t)
+	}
+	t.client = t.buildClient()
 	return t
 }
 
-func sendRequest(requestURL string, t *Twitch) ([]byte, error) {
-	// Build the request
-	client := &http.Client{}
-	req, _ := http.NewRequest("GET", requestURL, nil)
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", t.config.Token.AccessToken))
-	req.Header.Add("Client-Id", t.config.ClientID)
+func (t *Twitch) timeout() time.Duration {
+	if t.Timeout <= 0 {
+		return defaultRequestTimeout
+	}
+	return t.Timeout
+}
 
-	resp, err := client.Do(req)
+// doRequest sends a Helix request, waiting out the rate limit and retrying
+// failures the retry policy allows. Each attempt is limited to the client's
+// Timeout.
+func doRequest(ctx context.Context, r *Request, t *Twitch) ([]byte, error) {
+	method := r.Method
+	body, err := r.body()
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Error performing request: %v", err))
+		return nil, err
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Error reading response body: %v", err))
+	rateLimited := 0
+	refreshed := false
+	for attempt := 0; ; {
+		// Hold the request back while the rate limit bucket is empty
+		if err := t.rateLimit.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		accessToken, isAppToken, err := t.accessTokenFor(ctx, r.TokenType)
+		if err != nil {
+			return nil, err
+		}
+
+		// Build the request
+		attemptCtx, cancel := context.WithTimeout(ctx, t.timeout())
+		req, err := http.NewRequestWithContext(attemptCtx, method, r.url(t.BaseApiUrl), bytes.NewReader(body))
+		if err != nil {
+			cancel()
+			return nil, errors.New(fmt.Sprintf("Error building request: %v", err))
+		}
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Add("Client-Id", t.config.ClientID)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := t.client.Do(req)
+		var respBody []byte
+		if err == nil {
+			respBody, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				// The caller gave up, so there is no point retrying
+				return nil, ctx.Err()
+			} else if t.Retry.retryError(method, attempt, err) {
+				if err := t.Retry.wait(ctx, attempt); err != nil {
+					return nil, err
+				}
+				attempt++
+				continue
+			} else if resp == nil {
+				return nil, errors.New(fmt.Sprintf("Error performing request: %v", err))
+			}
+			return nil, errors.New(fmt.Sprintf("Error reading response body: %v", err))
+		}
+
+		t.rateLimit.update(resp.StatusCode, resp.Header)
+		if resp.StatusCode == http.StatusTooManyRequests && rateLimited < maxRateLimitRetries {
+			// The limiter waits for the bucket to reset before the retry
+			rateLimited++
+			continue
+		} else if t.Retry.retryStatus(method, attempt, resp.StatusCode) {
+			if err := t.Retry.wait(ctx, attempt); err != nil {
+				return nil, err
+			}
+			attempt++
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			apiErr := newAPIError(resp, respBody)
+			if isInvalidToken(apiErr) && !refreshed {
+				// The token was revoked or expired early, replay the
+				// request once with a fresh one
+				refreshed = true
+				if isAppToken {
+					_, err = t.renewAppToken(ctx, accessToken)
+				} else {
+					err = t.refreshStaleToken(ctx, accessToken)
+				}
+				if err == nil {
+					continue
+				}
+				log.Printf("Could not refresh rejected token: %v\n", err)
+			}
+			return nil, apiErr
+		}
+		return respBody, nil
 	}
-	return respBody, nil
 }
 
 func (t *Twitch) GetUserByLogin(login string) (User, error) {
-	requestURL := fmt.Sprintf("%s/users", t.BaseApiUrl)
+	return t.GetUserByLoginContext(context.Background(), login)
+}
+
+// GetUserByLoginContext is GetUserByLogin, giving up when ctx is done
+func (t *Twitch) GetUserByLoginContext(ctx context.Context, login string) (User, error) {
+	req := NewRequest("GET", "/users")
 	if len(login) > 0 {
-		requestURL += "?login=" + login
+		req.Param("login", login)
+	} else {
+		// Without a login Twitch returns the user the token belongs to
+		req.UseToken(TokenUser)
 	}
-	respBody, err := sendRequest(requestURL, t)
-	if err != nil {
+	u := new(UserResponse)
+	if err := t.Do(ctx, req, u); err != nil {
 		return User{}, err
 	}
-	u := new(UserResponse)
-	json.Unmarshal(respBody, &u)
+	// Twitch answers an unknown login with no users rather than a 404
+	if len(u.Data) == 0 {
+		return User{}, fmt.Errorf("user %s: %w", login, ErrNotFound)
+	}
 	return u.Data[0], nil
 }
 
 func (t *Twitch) GetLoggedInUser() (User, error) {
+	return t.GetLoggedInUserContext(context.Background())
+}
+
+// GetLoggedInUserContext is GetLoggedInUser, giving up when ctx is done
+func (t *Twitch) GetLoggedInUserContext(ctx context.Context) (User, error) {
+	t.userMu.Lock()
+	defer t.userMu.Unlock()
 	if len(t.user.ID) == 0 {
-		u, err := t.GetUserByLogin(t.user.Login)
+		u, err := t.GetUserByLoginContext(ctx, t.user.Login)
 		if err != nil {
 			return User{}, err
 		}
@@ -70,36 +198,87 @@ func (t *Twitch) GetLoggedInUser() (User, error) {
 	}
 }
 
+// GetFollowedStreams returns every live stream the user follows
 func (t *Twitch) GetFollowedStreams(u User) ([]Stream, error) {
-	requestURL := fmt.Sprintf("%s/streams/followed?user_id=%s", t.BaseApiUrl, u.ID)
-	respBody, err := sendRequest(requestURL, t)
-	if err != nil {
-		return nil, err
-	}
-	streams := new(StreamsResponse)
-	json.Unmarshal(respBody, &streams)
-	return streams.Data, nil
+	return t.GetFollowedStreamsContext(context.Background(), u)
+}
+
+// GetFollowedStreamsContext is GetFollowedStreams, giving up when ctx is done
+func (t *Twitch) GetFollowedStreamsContext(ctx context.Context, u User) ([]Stream, error) {
+	return t.PaginateFollowedStreamsContext(ctx, u, maxPageSize).All()
+}
+
+// PaginateFollowedStreams pages through the live streams the user follows,
+// first streams at a time
+func (t *Twitch) PaginateFollowedStreams(u User, first int) *Paginator[Stream] {
+	return t.PaginateFollowedStreamsContext(context.Background(), u, first)
+}
+
+// PaginateFollowedStreamsContext is PaginateFollowedStreams, with every page
+// requested under ctx
+func (t *Twitch) PaginateFollowedStreamsContext(ctx context.Context, u User, first int) *Paginator[Stream] {
+	req := NewRequest("GET", "/streams/followed").Param("user_id", u.ID).UseToken(TokenUser)
+	return newPaginator[Stream](ctx, t, req, first)
 }
 
 func (t *Twitch) GetChannelEmotes(u User) ([]Emote, error) {
-	requestURL := fmt.Sprintf("%s/chat/emotes?broadcaster_id=%s", t.BaseApiUrl, u.ID)
-	respBody, err := sendRequest(requestURL, t)
-	if err != nil {
-		return nil, err
-	}
-	emotes := new(EmotesResponse)
-	json.Unmarshal(respBody, &emotes)
-	return emotes.Data, nil
+	return t.GetChannelEmotesContext(context.Background(), u)
+}
+
+// GetChannelEmotesContext is GetChannelEmotes, giving up when ctx is done
+func (t *Twitch) GetChannelEmotesContext(ctx context.Context, u User) ([]Emote, error) {
+	return t.PaginateChannelEmotesContext(ctx, u, 0).All()
+}
+
+// PaginateChannelEmotes pages through the custom emotes of the user's
+// channel, first emotes at a time
+func (t *Twitch) PaginateChannelEmotes(u User, first int) *Paginator[Emote] {
+	return t.PaginateChannelEmotesContext(context.Background(), u, first)
+}
+
+// PaginateChannelEmotesContext is PaginateChannelEmotes, with every page
+// requested under ctx
+func (t *Twitch) PaginateChannelEmotesContext(ctx context.Context, u User, first int) *Paginator[Emote] {
+	req := NewRequest("GET", "/chat/emotes").Param("broadcaster_id", u.ID)
+	return newPaginator[Emote](ctx, t, req, first)
+}
+
+// GetGlobalChatBadges returns the badges that can appear in any channel
+func (t *Twitch) GetGlobalChatBadges() ([]ChatBadgeSet, error) {
+	return t.GetGlobalChatBadgesContext(context.Background())
+}
+
+// GetGlobalChatBadgesContext is GetGlobalChatBadges, giving up when ctx is
+// done
+func (t *Twitch) GetGlobalChatBadgesContext(ctx context.Context) ([]ChatBadgeSet, error) {
+	req := NewRequest("GET", "/chat/badges/global")
+	return newPaginator[ChatBadgeSet](ctx, t, req, 0).All()
+}
+
+// GetChannelChatBadges returns the custom subscriber and bits badges of the
+// user's channel
+func (t *Twitch) GetChannelChatBadges(u User) ([]ChatBadgeSet, error) {
+	return t.GetChannelChatBadgesContext(context.Background(), u)
+}
+
+// GetChannelChatBadgesContext is GetChannelChatBadges, giving up when ctx is
+// done
+func (t *Twitch) GetChannelChatBadgesContext(ctx context.Context, u User) ([]ChatBadgeSet, error) {
+	req := NewRequest("GET", "/chat/badges").Param("broadcaster_id", u.ID)
+	return newPaginator[ChatBadgeSet](ctx, t, req, 0).All()
 }
 
 func (t *Twitch) GetChatSettings(u User) (*ChatSettings, error) {
-	requestURL := fmt.Sprintf("%s/chat/settings?broadcaster_id=%s", t.BaseApiUrl, u.ID)
-	respBody, err := sendRequest(requestURL, t)
-	if err != nil {
+	return t.GetChatSettingsContext(context.Background(), u)
+}
+
+// GetChatSettingsContext is GetChatSettings, giving up when ctx is done
+func (t *Twitch) GetChatSettingsContext(ctx context.Context, u User) (*ChatSettings, error) {
+	req := NewRequest("GET", "/chat/settings").Param("broadcaster_id", u.ID)
+	settings := new(ChatSettingsResponse)
+	if err := t.Do(ctx, req, settings); err != nil {
 		return nil, err
 	}
-	settings := new(ChatSettingsResponse)
-	json.Unmarshal(respBody, &settings)
 
 	if len(settings.Data) > 0 {
 		return &settings.Data[0], nil
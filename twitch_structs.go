@@ -71,3 +71,37 @@ type ChatSettings struct {
 type ChatSettingsResponse struct {
 	Data []ChatSettings `json:"data"`
 }
+
+type ChatBadgeSet struct {
+	SetID    string             `json:"set_id"`
+	Versions []ChatBadgeVersion `json:"versions"`
+}
+
+type ChatBadgeVersion struct {
+	ID          string `json:"id"`
+	ImageURL1x  string `json:"image_url_1x"`
+	ImageURL2x  string `json:"image_url_2x"`
+	ImageURL4x  string `json:"image_url_4x"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ClickAction string `json:"click_action"`
+	ClickURL    string `json:"click_url"`
+}
+
+// FindChatBadge looks up a badge version in each list of badge sets in turn,
+// so channel badges can be passed before the global ones they override
+func FindChatBadge(set string, version string, badgeSets ...[]ChatBadgeSet) (ChatBadgeVersion, bool) {
+	for _, sets := range badgeSets {
+		for _, s := range sets {
+			if s.SetID != set {
+				continue
+			}
+			for _, v := range s.Versions {
+				if v.ID == version {
+					return v, true
+				}
+			}
+		}
+	}
+	return ChatBadgeVersion{}, false
+}
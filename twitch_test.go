@@ -1,6 +1,8 @@
 package twitchgo_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -10,7 +12,7 @@ import (
 	"github.com/brianmmcclain/twitchgo"
 )
 
-var testConfigJSON = "{\"client_id\": \"MyID\", \"client_secret\": \"MySecret\"}"
+var testConfigJSON = "{\"client_id\": \"MyID\", \"client_secret\": \"MySecret\", \"token\": {\"access_token\": \"MyToken\"}}"
 var testUserJSON = `{
 	"data": [
 			{
@@ -121,6 +123,31 @@ var testChannelEmotesJson = `{
 	"template": "https://static-cdn.jtvnw.net/emoticons/v2/{{id}}/{{format}}/{{theme_mode}}/{{scale}}"
 }`
 
+var testChatBadgesJson = `{
+	"data": [{
+		"set_id": "subscriber",
+		"versions": [{
+			"id": "0",
+			"image_url_1x": "https://static-cdn.jtvnw.net/badges/v1/sub0/1",
+			"image_url_2x": "https://static-cdn.jtvnw.net/badges/v1/sub0/2",
+			"image_url_4x": "https://static-cdn.jtvnw.net/badges/v1/sub0/3",
+			"title": "Subscriber",
+			"description": "Subscriber",
+			"click_action": "subscribe_to_channel",
+			"click_url": null
+		}, {
+			"id": "12",
+			"image_url_1x": "https://static-cdn.jtvnw.net/badges/v1/sub12/1",
+			"image_url_2x": "https://static-cdn.jtvnw.net/badges/v1/sub12/2",
+			"image_url_4x": "https://static-cdn.jtvnw.net/badges/v1/sub12/3",
+			"title": "1-Year Subscriber",
+			"description": "1-Year Subscriber",
+			"click_action": "subscribe_to_channel",
+			"click_url": null
+		}]
+	}]
+}`
+
 func TestGetUserByLogin(t *testing.T) {
 	// Set up the test server
 	svr := httptest.NewServer(http.HandlerFunc(
@@ -305,3 +332,67 @@ func verify(want, got interface{}, testName string, caseName string, t *testing.
 		t.Fatalf(`%s() %s = got %s, want %s`, testName, caseName, want, got)
 	}
 }
+
+func TestGetChatBadges(t *testing.T) {
+	const TEST_NAME = "GetChatBadges"
+
+	// Set up the test server
+	var paths []string
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.RequestURI())
+			fmt.Fprint(w, testChatBadgesJson)
+		}))
+	defer svr.Close()
+
+	// Make the request with a mock config
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c)
+	twitchConn.BaseApiUrl = svr.URL
+	global, err := twitchConn.GetGlobalChatBadges()
+	verify(err, nil, TEST_NAME, "ParseGlobalBadges", t)
+	channel, err := twitchConn.GetChannelChatBadges(testUser)
+	verify(err, nil, TEST_NAME, "ParseChannelBadges", t)
+
+	// Verify tests
+	verify(paths[0], "/chat/badges/global", TEST_NAME, "GlobalPath", t)
+	verify(paths[1], "/chat/badges?broadcaster_id=141981764", TEST_NAME, "ChannelPath", t)
+	verify(len(global), 1, TEST_NAME, "BadgeSetCount", t)
+	verify(channel[0].SetID, "subscriber", TEST_NAME, "SetID", t)
+
+	badge, ok := twitchgo.FindChatBadge("subscriber", "12", channel, global)
+	verify(ok, true, TEST_NAME, "FindChatBadge", t)
+	verify(badge.ImageURL1x, "https://static-cdn.jtvnw.net/badges/v1/sub12/1", TEST_NAME, "ImageURL1x", t)
+	_, ok = twitchgo.FindChatBadge("subscriber", "24", channel, global)
+	verify(ok, false, TEST_NAME, "FindMissingChatBadge", t)
+}
+
+func TestContextCancel(t *testing.T) {
+	// Set up the test server, never answering until the client gives up
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+	defer svr.Close()
+
+	c, _ := twitchgo.ParseConfig(testConfigJSON)
+	twitchConn := twitchgo.NewTwitch(c)
+	twitchConn.BaseApiUrl = svr.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := twitchConn.GetUserByLoginContext(ctx, "testUser"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf(`GetUserByLoginContext() = got error %v, want context.DeadlineExceeded`, err)
+	}
+
+	// Without a deadline on the context, the client's timeout applies to
+	// each attempt
+	twitchConn.Timeout = 20 * time.Millisecond
+	twitchConn.Retry = twitchgo.RetryPolicy{MaxAttempts: 2, Backoff: twitchgo.Backoff{Min: time.Millisecond}}
+	start := time.Now()
+	if _, err := twitchConn.GetUserByLogin("testUser"); err == nil {
+		t.Fatalf(`GetUserByLogin() = got no error, want a timeout`)
+	} else if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf(`GetUserByLogin() = returned after %s, want the timeout to apply`, elapsed)
+	}
+}
@@ -0,0 +1,407 @@
+package twitchgo
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The subset of RFC 6455 needed to speak IRC to Twitch over a WebSocket
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsCloseTimeout bounds how long sending the close frame may take
+const wsCloseTimeout = time.Second
+
+// wsMaxFrameSize bounds the payload we're willing to read in one frame
+const wsMaxFrameSize = 1 << 20
+
+// wsTransport sends IRC lines as WebSocket text messages. Frames are read on
+// their own goroutine so a read deadline never leaves a frame half read.
+type wsTransport struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+
+	lines  chan string
+	done   chan struct{}
+	err    error
+	closed chan struct{}
+	once   sync.Once
+
+	deadlineMu sync.Mutex
+	deadline   time.Time
+}
+
+func dialWebSocket(ctx context.Context, rawURL string, tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) (*wsTransport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid WebSocket URL %s: %v", rawURL, err))
+	}
+	secure := u.Scheme == "wss"
+	addr := u.Host
+	if len(u.Port()) == 0 {
+		if secure {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	conn, err := dialThroughProxy(ctx, addr, secure, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	if secure {
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if len(config.ServerName) == 0 {
+			config.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	reader, err := websocketHandshake(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t := &wsTransport{
+		conn:   conn,
+		reader: reader,
+		lines:  make(chan string, 64),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	go t.readLoop()
+	return t, nil
+}
+
+// dialThroughProxy opens a TCP connection to addr, tunnelling through the
+// HTTP proxy picked by the proxy func if there is one
+func dialThroughProxy(ctx context.Context, addr string, secure bool, proxy func(*http.Request) (*url.URL, error)) (net.Conn, error) {
+	var proxyURL *url.URL
+	if proxy != nil {
+		// The proxy func picks a proxy based on the scheme of the request
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		req, _ := http.NewRequest("GET", scheme+"://"+addr, nil)
+		var err error
+		proxyURL, err = proxy(req)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Error finding proxy: %v", err))
+		}
+	}
+	dialer := &net.Dialer{}
+	if proxyURL == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	proxyAddr := proxyURL.Host
+	if len(proxyURL.Port()) == 0 {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not connect to proxy: %v", err))
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.New(fmt.Sprintf("Proxy refused connection: %s", resp.Status))
+	}
+	return conn, nil
+}
+
+// websocketHandshake upgrades the connection, returning the reader to use for
+// frames afterwards
+func websocketHandshake(conn net.Conn, u *url.URL) (*bufio.Reader, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: "GET",
+		URL:    &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{},
+	}
+	if len(req.URL.Path) == 0 {
+		req.URL.Path = "/"
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, errors.New(fmt.Sprintf("WebSocket upgrade failed: %s", resp.Status))
+	} else if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, errors.New("WebSocket upgrade failed: invalid Sec-WebSocket-Accept")
+	}
+	return reader, nil
+}
+
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// readLoop reads frames until the connection fails, answering pings and
+// splitting text messages into IRC lines
+func (t *wsTransport) readLoop() {
+	defer close(t.done)
+
+	var message []byte
+	for {
+		op, fin, payload, err := readWebSocketFrame(t.reader)
+		if err != nil {
+			t.err = err
+			return
+		}
+
+		switch op {
+		case wsOpPing:
+			t.writeFrame(wsOpPong, payload)
+		case wsOpClose:
+			t.writeFrame(wsOpClose, payload)
+			t.err = io.EOF
+			return
+		case wsOpText, wsOpBinary, wsOpContinuation:
+			message = append(message, payload...)
+			if !fin {
+				continue
+			}
+			// A single message may hold several IRC lines
+			for _, line := range strings.Split(string(message), "\n") {
+				line = trimCRLF(line)
+				if len(line) == 0 {
+					continue
+				}
+				select {
+				case t.lines <- line:
+				case <-t.closed:
+					t.err = net.ErrClosed
+					return
+				}
+			}
+			message = nil
+		}
+	}
+}
+
+func (t *wsTransport) ReadLine() (string, error) {
+	t.deadlineMu.Lock()
+	deadline := t.deadline
+	t.deadlineMu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case line := <-t.lines:
+		return line, nil
+	case <-t.done:
+		// Hand out anything read before the connection failed first
+		select {
+		case line := <-t.lines:
+			return line, nil
+		default:
+			return "", t.err
+		}
+	case <-timeout:
+		return "", os.ErrDeadlineExceeded
+	}
+}
+
+func (t *wsTransport) WriteLine(line string) error {
+	return t.writeFrame(wsOpText, []byte(line+"\r\n"))
+}
+
+func (t *wsTransport) SetReadDeadline(deadline time.Time) error {
+	t.deadlineMu.Lock()
+	defer t.deadlineMu.Unlock()
+	t.deadline = deadline
+	return nil
+}
+
+func (t *wsTransport) Close() error {
+	err := net.ErrClosed
+	t.once.Do(func() {
+		// Say goodbye unless a write is stuck on a peer that isn't reading,
+		// in which case closing the connection below unblocks it
+		if t.writeMu.TryLock() {
+			t.conn.SetWriteDeadline(time.Now().Add(wsCloseTimeout))
+			writeWebSocketFrame(t.conn, wsOpClose, nil, true)
+			t.writeMu.Unlock()
+		}
+		close(t.closed)
+		err = t.conn.Close()
+	})
+	return err
+}
+
+func (t *wsTransport) writeFrame(op byte, payload []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return writeWebSocketFrame(t.conn, op, payload, true)
+}
+
+// writeWebSocketFrame writes a single final frame. Frames sent by a client
+// must be masked.
+func writeWebSocketFrame(w io.Writer, op byte, payload []byte, masked bool) error {
+	frame := []byte{0x80 | op, 0}
+	length := len(payload)
+	switch {
+	case length < 126:
+		frame[1] = byte(length)
+	case length <= 0xFFFF:
+		frame[1] = 126
+		ext := make([]byte, 2)
+		binary.BigEndian.PutUint16(ext, uint16(length))
+		frame = append(frame, ext...)
+	default:
+		frame[1] = 127
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(length))
+		frame = append(frame, ext...)
+	}
+
+	if masked {
+		frame[1] |= 0x80
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		frame = append(frame, mask...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readWebSocketFrame reads a single frame, unmasking its payload if needed
+func readWebSocketFrame(r *bufio.Reader) (byte, bool, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, false, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	op := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, false, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return 0, false, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if length > wsMaxFrameSize {
+		return 0, false, nil, errors.New(fmt.Sprintf("WebSocket frame of %d bytes is too large", length))
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return 0, false, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, false, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return op, fin, payload, nil
+}
@@ -0,0 +1,141 @@
+package twitchgo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFakeWebSocketServer upgrades each request and hands the server side of
+// the connection to handle
+func newFakeWebSocketServer(t *testing.T, handle func(rw *bufio.ReadWriter)) *httptest.Server {
+	svr := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+				http.Error(w, "not a websocket request", http.StatusBadRequest)
+				return
+			}
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf(`Hijack() = got error: %s`, err)
+				return
+			}
+			defer conn.Close()
+
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+			rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+			rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+			rw.Flush()
+			handle(rw)
+		}))
+	t.Cleanup(svr.Close)
+	return svr
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	received := make(chan string, 10)
+	svr := newFakeWebSocketServer(t, func(rw *bufio.ReadWriter) {
+		// Answer the login, check that pings get a pong, then send two IRC
+		// lines in a single message
+		for {
+			op, _, payload, err := readWebSocketFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			if op == wsOpText {
+				received <- string(payload)
+				if strings.HasPrefix(string(payload), "JOIN") {
+					writeWebSocketFrame(rw, wsOpPing, []byte("keepalive"), false)
+					rw.Flush()
+				}
+			} else if op == wsOpPong {
+				received <- "pong:" + string(payload)
+				writeWebSocketFrame(rw, wsOpText, []byte(":tmi.twitch.tv 001 bot :Welcome, GLHF!\r\n:viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :over websocket\r\n"), false)
+				rw.Flush()
+			}
+		}
+	})
+
+	transport, err := dialWebSocket(context.Background(), "ws"+strings.TrimPrefix(svr.URL, "http"), nil, func(*http.Request) (*url.URL, error) { return nil, nil })
+	if err != nil {
+		t.Fatalf(`dialWebSocket() = got error: %s`, err)
+	}
+	defer transport.Close()
+
+	transport.WriteLine("JOIN #channel")
+	for _, want := range []string{"JOIN #channel\r\n", "pong:keepalive"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf(`wsTransport = server got %q, want %q`, got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf(`wsTransport = server did not receive %q`, want)
+		}
+	}
+
+	transport.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{":tmi.twitch.tv 001 bot :Welcome, GLHF!", ":viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #channel :over websocket"} {
+		line, err := transport.ReadLine()
+		if err != nil {
+			t.Fatalf(`ReadLine() = got error: %s`, err)
+		} else if line != want {
+			t.Fatalf(`ReadLine() = got %q, want %q`, line, want)
+		}
+	}
+
+	// Nothing else is sent, so the deadline should pass
+	transport.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := transport.ReadLine(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf(`ReadLine() = got %v, want deadline exceeded`, err)
+	}
+}
+
+func TestWebSocketCloseUnblocksWrites(t *testing.T) {
+	// Nothing reads the other end of the pipe, so writes block
+	client, server := net.Pipe()
+	defer server.Close()
+	transport := &wsTransport{conn: client, reader: bufio.NewReader(client), lines: make(chan string), done: make(chan struct{}), closed: make(chan struct{})}
+
+	written := make(chan error, 1)
+	go func() { written <- transport.WriteLine("PRIVMSG #channel :stuck") }()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		transport.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf(`Close() = blocked behind a pending write`)
+	}
+	if err := <-written; err == nil {
+		t.Fatalf(`WriteLine() = got no error after Close()`)
+	}
+}
+
+func TestWebSocketFrameSizes(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 65535, 65536} {
+		var b strings.Builder
+		payload := []byte(strings.Repeat("a", size))
+		if err := writeWebSocketFrame(&b, wsOpText, payload, true); err != nil {
+			t.Fatalf(`writeWebSocketFrame(%d) = got error: %s`, size, err)
+		}
+		op, fin, got, err := readWebSocketFrame(bufio.NewReader(strings.NewReader(b.String())))
+		if err != nil {
+			t.Fatalf(`readWebSocketFrame(%d) = got error: %s`, size, err)
+		} else if op != wsOpText || !fin || string(got) != string(payload) {
+			t.Fatalf(`readWebSocketFrame(%d) = got op %d, fin %t, %d bytes`, size, op, fin, len(got))
+		}
+	}
+}